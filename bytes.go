@@ -0,0 +1,114 @@
+package metadat
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+)
+
+// Encodings of the bytes type in the data section
+const (
+	base64Encoding = "base64"
+	hexEncoding    = "hex"
+)
+
+// parseBytesType parses the encoding parameter of a bytes(encoding) type. Base64 is the
+// default encoding, so it is not kept in the FieldType.
+func parseBytesType(encoding string) (FieldType, error) {
+	switch encoding {
+	case base64Encoding:
+		return FieldType{Type: "bytes"}, nil
+	case hexEncoding:
+		return FieldType{Type: "bytes", Encoding: hexEncoding}, nil
+	default:
+		return FieldType{}, fmt.Errorf("unknown bytes encoding: %s", encoding)
+	}
+}
+
+// isByteSequence reports whether a Go type is a byte slice or array, written as bytes
+// rather than as an array of integers
+func isByteSequence(t reflect.Type) bool {
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() == reflect.Uint8
+}
+
+// parseBytesValue decodes the text of a bytes value. An empty value is written as "".
+func parseBytesValue(fieldType FieldType, valueStr string) ([]byte, error) {
+	if valueStr == `""` {
+		return []byte{}, nil
+	}
+	return decodeBytes(fieldType, valueStr)
+}
+
+// decodeBytes decodes text in the encoding of a bytes type
+func decodeBytes(fieldType FieldType, text string) ([]byte, error) {
+	if fieldType.Encoding == hexEncoding {
+		data, err := hex.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex value: %s", text)
+		}
+		return data, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 value: %s", text)
+	}
+	return data, nil
+}
+
+// toBytes converts a []byte, or the encoded text of one, into a []byte
+func toBytes(value interface{}, fieldType FieldType) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return decodeBytes(fieldType, v)
+	default:
+		return nil, fmt.Errorf("expected bytes, got %T", value)
+	}
+}
+
+// formatBytesValue encodes a bytes value for the data section
+func formatBytesValue(value interface{}, fieldType FieldType) (string, error) {
+	data, err := toBytes(value, fieldType)
+	if err != nil {
+		return "", err
+	}
+	if len(data) == 0 {
+		return `""`, nil
+	}
+	return encodeBytes(data, fieldType), nil
+}
+
+// encodeBytes encodes data in the encoding of a bytes type
+func encodeBytes(data []byte, fieldType FieldType) string {
+	if fieldType.Encoding == hexEncoding {
+		return hex.EncodeToString(data)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// assignBytes stores a parsed bytes value into a byte slice, a byte array of the same
+// length, or a string holding the encoded text
+func assignBytes(dst reflect.Value, src interface{}, fieldType FieldType, path string) error {
+	data, err := toBytes(src, fieldType)
+	if err != nil {
+		return fmt.Errorf("%s: %v", describePath(path), err)
+	}
+
+	switch {
+	case dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() == reflect.Uint8:
+		dst.SetBytes(append([]byte{}, data...))
+	case dst.Kind() == reflect.Array && dst.Type().Elem().Kind() == reflect.Uint8:
+		if dst.Len() != len(data) {
+			return fmt.Errorf("cannot assign %d bytes to Go type %s for %s", len(data), dst.Type(), describePath(path))
+		}
+		reflect.Copy(dst, reflect.ValueOf(data))
+	case dst.Kind() == reflect.String:
+		dst.SetString(encodeBytes(data, fieldType))
+	default:
+		return assignError(fieldType, dst.Type(), path)
+	}
+	return nil
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/apaichon/metadat-go"
 )
@@ -53,13 +55,13 @@ func main() {
 	case "json-to-metadat":
 		result, err = convertJSONToMetaDat(string(content), *separated, *schemaFile, *dataFile)
 	case "metadat-to-json":
-		result, err = convertMetaDatToJSON(string(content), *schemaFile, *dataFile)
+		result, err = convertMetaDatToJSON(string(content), *inputFile, *schemaFile, *dataFile)
 	case "parse":
-		result, err = parseMetaDat(string(content), *schemaFile, *dataFile)
+		result, err = parseMetaDat(string(content), *inputFile, *schemaFile, *dataFile)
 	case "validate":
-		result, err = validateMetaDat(string(content), *schemaFile, *dataFile)
+		result, err = validateMetaDat(string(content), *inputFile, *schemaFile, *dataFile)
 	case "auto":
-		result, err = autoConvert(string(content), *separated, *schemaFile, *dataFile)
+		result, err = autoConvert(string(content), *inputFile, *separated, *schemaFile, *dataFile)
 	default:
 		fmt.Fprintf(os.Stderr, "Error: unknown mode '%s'\n", *mode)
 		os.Exit(1)
@@ -90,7 +92,7 @@ USAGE:
     metadat [OPTIONS] -input <file>
 
 MODES:
-    json-to-metadat    Convert JSON to MetaDat format
+    json-to-metadat    Convert JSON (an object or an array of records) to MetaDat format
     metadat-to-json    Convert MetaDat to JSON format  
     parse             Parse MetaDat and display structure
     validate          Validate MetaDat format
@@ -133,18 +135,24 @@ func convertJSONToMetaDat(jsonContent string, separated bool, schemaFile, dataFi
 			return "", fmt.Errorf("schema and data files must be specified for separated mode")
 		}
 
-		// Parse JSON
-		var data map[string]interface{}
-		if err := json.Unmarshal([]byte(jsonContent), &data); err != nil {
-			return "", fmt.Errorf("invalid JSON: %v", err)
+		// Parse JSON, keeping the key order of the document
+		data, schema, err := metadat.DecodeJSON([]byte(jsonContent))
+		if err != nil {
+			return "", err
 		}
 
-		// Infer schema and write separated files
-		schema := metadat.InferSchemaFromJSON(data)
+		// Write separated files
 		writer := metadat.NewWriter()
 		writer.SetSchema(schema)
 
-		err := writer.WriteToFiles(data, schemaFile, dataFile)
+		switch root := data.(type) {
+		case map[string]interface{}:
+			err = writer.WriteToFiles(root, schemaFile, dataFile)
+		case []interface{}:
+			err = writer.WriteArrayToFiles(root, schemaFile, dataFile)
+		default:
+			return "", fmt.Errorf("JSON must be an object or an array at root level")
+		}
 		if err != nil {
 			return "", fmt.Errorf("failed to write separated files: %v", err)
 		}
@@ -156,26 +164,15 @@ func convertJSONToMetaDat(jsonContent string, separated bool, schemaFile, dataFi
 	return metadat.ConvertJSONToMetaDat(jsonContent)
 }
 
-func convertMetaDatToJSON(metadatContent, schemaFile, dataFile string) (string, error) {
-	// Create parser
+func convertMetaDatToJSON(metadatContent, inputFile, schemaFile, dataFile string) (string, error) {
 	parser := metadat.NewParser()
-	var data map[string]interface{}
-	var err error
-
-	if schemaFile != "" && dataFile != "" {
-		// Parse from separated files
-		data, err = parser.ParseFromFiles(schemaFile, dataFile)
-	} else {
-		// Parse from single file
-		data, err = parser.ParseMetaDat(metadatContent)
-	}
-
+	data, err := parseDocument(parser, metadatContent, inputFile, schemaFile, dataFile)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse MetaDat: %v", err)
 	}
 
 	// Convert to JSON
-	jsonBytes, err := json.MarshalIndent(data, "", "  ")
+	jsonBytes, err := json.MarshalIndent(parser.Schema().JSONValue(data), "", "  ")
 	if err != nil {
 		return "", fmt.Errorf("failed to convert to JSON: %v", err)
 	}
@@ -183,26 +180,25 @@ func convertMetaDatToJSON(metadatContent, schemaFile, dataFile string) (string,
 	return string(jsonBytes), nil
 }
 
-func parseMetaDat(metadatContent, schemaFile, dataFile string) (string, error) {
-	// Create parser
-	parser := metadat.NewParser()
-	var data map[string]interface{}
-	var err error
-
-	if schemaFile != "" && dataFile != "" {
-		// Parse from separated files
-		data, err = parser.ParseFromFiles(schemaFile, dataFile)
-	} else {
-		// Parse from single file
-		data, err = parser.ParseMetaDat(metadatContent)
-	}
-
+func parseMetaDat(metadatContent, inputFile, schemaFile, dataFile string) (string, error) {
+	document, err := parseDocument(metadat.NewParser(), metadatContent, inputFile, schemaFile, dataFile)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse MetaDat: %v", err)
 	}
 
 	// Display structure
 	result := fmt.Sprintf("Successfully parsed MetaDat file\n")
+
+	records, isArray := document.([]interface{})
+	if isArray {
+		result += fmt.Sprintf("Records found: %d\n", len(records))
+		if len(records) > 0 {
+			result += fmt.Sprintf("First record: %v (%T)\n", records[0], records[0])
+		}
+		return result, nil
+	}
+
+	data := document.(map[string]interface{})
 	result += fmt.Sprintf("Fields found: %d\n\n", len(data))
 
 	for key, value := range data {
@@ -236,19 +232,19 @@ func parseMetaDat(metadatContent, schemaFile, dataFile string) (string, error) {
 	return result, nil
 }
 
-func validateMetaDat(metadatContent, schemaFile, dataFile string) (string, error) {
-	// Create parser
+func validateMetaDat(metadatContent, inputFile, schemaFile, dataFile string) (string, error) {
+	// Report every problem in one run rather than stopping at the first
 	parser := metadat.NewParser()
-	var err error
-
-	if schemaFile != "" && dataFile != "" {
-		// Validate separated files
-		_, err = parser.ParseFromFiles(schemaFile, dataFile)
-	} else {
-		// Validate single file
-		_, err = parser.ParseMetaDat(metadatContent)
+	parser.SetCollectErrors(true)
+	_, err := parseDocument(parser, metadatContent, inputFile, schemaFile, dataFile)
+	var errs metadat.ErrorList
+	if errors.As(err, &errs) && len(errs) > 1 {
+		messages := make([]string, len(errs))
+		for i, e := range errs {
+			messages[i] = e.Error()
+		}
+		return "", fmt.Errorf("validation failed with %d errors:\n%s", len(errs), strings.Join(messages, "\n"))
 	}
-
 	if err != nil {
 		return "", fmt.Errorf("validation failed: %v", err)
 	}
@@ -256,9 +252,9 @@ func validateMetaDat(metadatContent, schemaFile, dataFile string) (string, error
 	return "✓ MetaDat file is valid\n", nil
 }
 
-func autoConvert(content string, separated bool, schemaFile, dataFile string) (string, error) {
+func autoConvert(content, inputFile string, separated bool, schemaFile, dataFile string) (string, error) {
 	// Try to detect format by parsing as JSON first
-	var jsonData map[string]interface{}
+	var jsonData interface{}
 	if err := json.Unmarshal([]byte(content), &jsonData); err == nil {
 		// It's valid JSON, convert to MetaDat
 		return convertJSONToMetaDat(content, separated, schemaFile, dataFile)
@@ -266,10 +262,104 @@ func autoConvert(content string, separated bool, schemaFile, dataFile string) (s
 
 	// Try to parse as MetaDat
 	parser := metadat.NewParser()
-	if _, err := parser.ParseMetaDat(content); err == nil {
+	if _, err := parser.ParseDocument(content); err == nil {
 		// It's valid MetaDat, convert to JSON
-		return convertMetaDatToJSON(content, schemaFile, dataFile)
+		return convertMetaDatToJSON(content, inputFile, schemaFile, dataFile)
 	}
 
 	return "", fmt.Errorf("unable to detect input format (not valid JSON or MetaDat)")
-}
\ No newline at end of file
+}
+
+// parseDocument parses a MetaDat document from a single file's content or from separated
+// schema and data files. The result is a map for object documents and a slice for array documents.
+// Parse errors point at the file, line and column they were found at.
+func parseDocument(parser *metadat.Parser, metadatContent, inputFile, schemaFile, dataFile string) (interface{}, error) {
+	if schemaFile != "" && dataFile != "" {
+		// Parse the schema on its own first so its errors are reported against the schema file
+		schemaContent, err := os.ReadFile(schemaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema file: %v", err)
+		}
+		if err := parser.ParseSchema(string(schemaContent)); err != nil {
+			return nil, sourceError(err, schemaFile, string(schemaContent))
+		}
+
+		// Parse from separated files
+		document, err := parser.ParseDocumentFromFiles(schemaFile, dataFile)
+		if err != nil {
+			dataContent, _ := os.ReadFile(dataFile)
+			return nil, sourceError(err, dataFile, string(dataContent))
+		}
+		return document, nil
+	}
+
+	// Parse from single file
+	document, err := parser.ParseDocument(metadatContent)
+	if err != nil {
+		return nil, sourceError(err, inputFile, metadatContent)
+	}
+	return document, nil
+}
+
+// sourceError formats a structured parse error as "file:line:column: path: message",
+// followed by the offending source line with a caret under the column. The errors of an
+// ErrorList are formatted one after the other. Other errors are returned unchanged.
+func sourceError(err error, filename, content string) error {
+	var list metadat.ErrorList
+	if errors.As(err, &list) {
+		formatted := make(metadat.ErrorList, len(list))
+		for i, e := range list {
+			formatted[i] = sourceError(e, filename, content)
+		}
+		return formatted
+	}
+
+	var (
+		pos    metadat.Position
+		msg    string
+		syntax *metadat.SyntaxError
+		typed  *metadat.TypeError
+		schema *metadat.SchemaError
+	)
+	switch {
+	case errors.As(err, &syntax):
+		pos, msg = syntax.Position, syntax.Msg
+	case errors.As(err, &typed):
+		pos, msg = typed.Position, typed.Msg
+	case errors.As(err, &schema):
+		pos, msg = schema.Position, schema.Msg
+	default:
+		return err
+	}
+
+	location := filename
+	if pos.Line > 0 {
+		location += fmt.Sprintf(":%d", pos.Line)
+		if pos.Column > 0 {
+			location += fmt.Sprintf(":%d", pos.Column)
+		}
+	}
+	if pos.Path != "" {
+		msg = pos.Path + ": " + msg
+	}
+	message := fmt.Sprintf("%s: %s", location, msg)
+
+	lines := strings.Split(content, "\n")
+	if pos.Line > 0 && pos.Line <= len(lines) {
+		source := strings.TrimRight(lines[pos.Line-1], "\r")
+		message += "\n    " + source
+		if pos.Column > 0 && pos.Column <= len(source)+1 {
+			// Keep tabs in the caret indentation so it lines up with the source
+			var caret strings.Builder
+			for _, c := range source[:pos.Column-1] {
+				if c == '\t' {
+					caret.WriteRune('\t')
+				} else {
+					caret.WriteRune(' ')
+				}
+			}
+			message += "\n    " + caret.String() + "^"
+		}
+	}
+	return errors.New(message)
+}
@@ -0,0 +1,208 @@
+package metadat
+
+import (
+	"encoding"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Decimal is an exact decimal number, the Go value of the decimal type. Decimals keep the
+// digits they were written with, so 12.50 stays 12.50, and can be compared with ==.
+// The zero value is 0.
+type Decimal struct {
+	text string // canonical text, empty for the zero value
+}
+
+var decimalType = reflect.TypeOf(Decimal{})
+
+// ParseDecimal parses a decimal number written as an optional sign, digits and an optional
+// fractional part, such as -12.50. Exponents are not accepted.
+func ParseDecimal(s string) (Decimal, error) {
+	digits, negative := strings.CutPrefix(s, "-")
+	if !negative {
+		digits = strings.TrimPrefix(digits, "+")
+	}
+	intPart, fracPart, hasPoint := strings.Cut(digits, ".")
+	if !isDigits(intPart) || (hasPoint && !isDigits(fracPart)) {
+		return Decimal{}, fmt.Errorf("invalid decimal value: %s", s)
+	}
+
+	intPart = strings.TrimLeft(intPart, "0")
+	if intPart == "" {
+		intPart = "0"
+	}
+	text := intPart
+	if hasPoint {
+		text += "." + fracPart
+	}
+	if negative && strings.Trim(intPart+fracPart, "0") != "" {
+		text = "-" + text
+	}
+	return Decimal{text: text}, nil
+}
+
+// isDigits reports whether s is a non-empty run of ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the decimal in its canonical form
+func (d Decimal) String() string {
+	if d.text == "" {
+		return "0"
+	}
+	return d.text
+}
+
+// Scale returns the number of digits after the decimal point
+func (d Decimal) Scale() int {
+	_, fracPart, _ := strings.Cut(d.text, ".")
+	return len(fracPart)
+}
+
+// Precision returns the number of digits, not counting leading zeros of the integer part
+func (d Decimal) Precision() int {
+	intPart, _, _ := strings.Cut(strings.TrimPrefix(d.text, "-"), ".")
+	if intPart == "" || intPart == "0" {
+		return d.Scale()
+	}
+	return len(intPart) + d.Scale()
+}
+
+// Rat returns the value of the decimal as an exact rational number
+func (d Decimal) Rat() *big.Rat {
+	r, _ := new(big.Rat).SetString(d.String())
+	return r
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (d *Decimal) UnmarshalText(text []byte) error {
+	parsed, err := ParseDecimal(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// parseDecimalType parses the parameters of a decimal(p) or decimal(p,s) type
+func parseDecimalType(params string) (FieldType, error) {
+	precisionStr, scaleStr, hasScale := strings.Cut(params, ",")
+	precision, err := strconv.Atoi(strings.TrimSpace(precisionStr))
+	if err != nil || precision < 1 {
+		return FieldType{}, fmt.Errorf("invalid decimal precision: %s", strings.TrimSpace(precisionStr))
+	}
+	scale := 0
+	if hasScale {
+		scale, err = strconv.Atoi(strings.TrimSpace(scaleStr))
+		if err != nil || scale < 0 {
+			return FieldType{}, fmt.Errorf("invalid decimal scale: %s", strings.TrimSpace(scaleStr))
+		}
+		if scale > precision {
+			return FieldType{}, fmt.Errorf("decimal scale %d exceeds precision %d", scale, precision)
+		}
+	}
+	return FieldType{Type: "decimal", Precision: precision, Scale: scale}, nil
+}
+
+// parseDecimalValue converts the text of a decimal value, checking it against the precision
+// and scale of its type
+func parseDecimalValue(fieldType FieldType, valueStr string) (Decimal, error) {
+	d, err := ParseDecimal(valueStr)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return d, checkDecimal(d, fieldType)
+}
+
+// checkDecimal reports a value with more decimal places, or more integer digits, than the
+// precision and scale of its type allow
+func checkDecimal(d Decimal, fieldType FieldType) error {
+	if fieldType.Precision == 0 {
+		return nil
+	}
+	if d.Scale() > fieldType.Scale {
+		return fmt.Errorf("value %s has more than %d decimal places for %s", d, fieldType.Scale, fieldTypeToString(fieldType))
+	}
+	if d.Precision()-d.Scale() > fieldType.Precision-fieldType.Scale {
+		return fmt.Errorf("value %s out of range for %s", d, fieldTypeToString(fieldType))
+	}
+	return nil
+}
+
+// toDecimal converts a Decimal, its text, or a Go number into a Decimal that fits the
+// precision and scale of its type
+func toDecimal(value interface{}, fieldType FieldType) (Decimal, error) {
+	var d Decimal
+	var err error
+	switch v := value.(type) {
+	case Decimal:
+		d = v
+	case string:
+		d, err = ParseDecimal(v)
+	case float32:
+		d, err = ParseDecimal(strconv.FormatFloat(float64(v), 'f', -1, 32))
+	case float64:
+		d, err = ParseDecimal(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		negative, magnitude, intErr := integerParts(value)
+		if intErr != nil {
+			return Decimal{}, fmt.Errorf("expected decimal, got %T", value)
+		}
+		text := strconv.FormatUint(magnitude, 10)
+		if negative {
+			text = "-" + text
+		}
+		d, err = ParseDecimal(text)
+	}
+	if err != nil {
+		return Decimal{}, err
+	}
+	return d, checkDecimal(d, fieldType)
+}
+
+// assignDecimal stores a parsed decimal value into a Decimal or other type implementing
+// encoding.TextUnmarshaler, a string holding its text, or a float
+func assignDecimal(dst reflect.Value, src interface{}, fieldType FieldType, path string) error {
+	d, err := toDecimal(src, fieldType)
+	if err != nil {
+		return fmt.Errorf("%s: %v", describePath(path), err)
+	}
+
+	if dst.CanAddr() && dst.Addr().Type().Implements(textUnmarshalerType) {
+		if err := dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(d.String())); err != nil {
+			return fmt.Errorf("cannot unmarshal %s: %v", describePath(path), err)
+		}
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.String:
+		dst.SetString(d.String())
+	case reflect.Float32, reflect.Float64:
+		f, _ := d.Rat().Float64()
+		if dst.OverflowFloat(f) {
+			return fmt.Errorf("value %s overflows Go type %s for %s", d, dst.Type(), describePath(path))
+		}
+		dst.SetFloat(f)
+	default:
+		return assignError(fieldType, dst.Type(), path)
+	}
+	return nil
+}
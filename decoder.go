@@ -0,0 +1,452 @@
+package metadat
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TokenKind identifies the kind of a Token produced by a Decoder
+type TokenKind int
+
+const (
+	// FieldToken carries the complete value of a non-array field
+	FieldToken TokenKind = iota
+	// ArrayStartToken opens an array field; Len holds its declared size
+	ArrayStartToken
+	// ElementToken carries a single array element
+	ElementToken
+	// ArrayEndToken closes the array field opened by the last ArrayStartToken
+	ArrayEndToken
+)
+
+// String returns the name of the token kind
+func (k TokenKind) String() string {
+	switch k {
+	case FieldToken:
+		return "Field"
+	case ArrayStartToken:
+		return "ArrayStart"
+	case ElementToken:
+		return "Element"
+	case ArrayEndToken:
+		return "ArrayEnd"
+	default:
+		return fmt.Sprintf("TokenKind(%d)", int(k))
+	}
+}
+
+// Token is a unit of data section content produced by a Decoder
+type Token struct {
+	Kind  TokenKind
+	Name  string      // field name
+	Value interface{} // field value for FieldToken, element value for ElementToken
+	Index int         // element position for ElementToken
+	Len   int         // declared size for ArrayStartToken, -1 when not declared
+}
+
+// Decoder reads a MetaDat document from an io.Reader incrementally.
+// The meta section is read once; the data section is then returned one field,
+// or one array element, at a time so memory use does not grow with array size.
+//
+//	dec := metadat.NewDecoder(file)
+//	for dec.Next() {
+//	    tok := dec.Token()
+//	    ...
+//	}
+//	if err := dec.Err(); err != nil { ... }
+type Decoder struct {
+	lines     *lineReader
+	schema    Schema
+	hasSchema bool
+	indent    int // indentation of field headers, -1 until the first header is read
+	seen      map[string]bool
+	array     *arrayState
+	token     Token
+	err       error
+	collect   bool      // continue after errors in the data, see SetCollectErrors
+	errs      ErrorList // errors recorded while collecting
+	loader    Loader    // loads the files named by import directives, see SetLoader
+}
+
+// arrayState tracks the array field currently being streamed
+type arrayState struct {
+	name      string
+	fieldType FieldType
+	declared  int           // declared size, -1 when not declared
+	indent    int           // indentation of the array header line
+	line      int           // line number of the array header
+	inline    []interface{} // elements written on the header line
+	isInline  bool
+	count     int
+}
+
+// NewDecoder creates a Decoder reading a complete MetaDat document with meta and data sections
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{lines: newLineReader(r), indent: -1}
+}
+
+// NewDataDecoder creates a Decoder reading a data section on its own, as written in
+// separated files mode, using the given schema
+func NewDataDecoder(r io.Reader, schema Schema) *Decoder {
+	return &Decoder{lines: newLineReader(r), schema: schema, hasSchema: true, indent: -1}
+}
+
+// SetCollectErrors makes the Decoder continue after errors instead of stopping at the first
+// one. Every error is recorded and the offending field or array element is skipped; Err then
+// returns an ErrorList of all of them. Errors in the meta section are all reported, but the
+// data section is not read when there are any.
+func (d *Decoder) SetCollectErrors(collect bool) {
+	d.collect = collect
+}
+
+// SetLoader sets the Loader that reads the schema files named by import directives in the
+// meta section. By default imports are rejected.
+func (d *Decoder) SetLoader(loader Loader) {
+	d.loader = loader
+}
+
+// Schema reads the meta section, if it has not been read yet, and returns the parsed schema
+func (d *Decoder) Schema() (Schema, error) {
+	if d.hasSchema || d.err != nil {
+		return d.schema, d.err
+	}
+
+	var meta []line
+	first := true
+	for {
+		l, ok := d.lines.next()
+		if !ok {
+			if d.lines.err != nil {
+				d.fail(d.lines.err)
+			} else {
+				d.fail(&SyntaxError{Msg: "invalid MetaDat format: must have 'meta' and 'data' sections"})
+			}
+			return d.schema, d.err
+		}
+
+		trimmed := strings.TrimSpace(l.text)
+		if first && trimmed == "meta" {
+			first = false
+			continue
+		}
+		if trimmed == "data" {
+			break
+		}
+		if trimmed != "" {
+			first = false
+		}
+		meta = append(meta, l)
+	}
+
+	schema, errs := parseSchemaLines(meta, newImporter(d.loader, ""))
+	if len(errs) > 0 {
+		if d.collect {
+			d.errs = append(d.errs, errs[:len(errs)-1]...)
+		}
+		d.fail(errs[len(errs)-1])
+		return d.schema, d.err
+	}
+	d.schema = schema
+	d.hasSchema = true
+
+	return d.schema, nil
+}
+
+// Next advances to the next token, returning false at the end of the document or on error
+func (d *Decoder) Next() bool {
+	if d.err != nil {
+		return false
+	}
+	if _, err := d.Schema(); err != nil {
+		return false
+	}
+	if d.array != nil {
+		return d.nextElement()
+	}
+	return d.nextField()
+}
+
+// Token returns the token read by the last successful call to Next
+func (d *Decoder) Token() Token {
+	return d.token
+}
+
+// Err returns the first error encountered by the Decoder or, when collecting errors,
+// an ErrorList of all errors found so far
+func (d *Decoder) Err() error {
+	if d.collect {
+		return d.errs.Err()
+	}
+	return d.err
+}
+
+// nextField reads the next field header together with its value or, for arrays,
+// opens the array so its elements can be streamed. When collecting errors, fields
+// with errors are reported and skipped.
+func (d *Decoder) nextField() bool {
+	for {
+		header, ok := d.nextContentLine()
+		if !ok {
+			if d.err == nil {
+				d.checkRequired()
+			}
+			return false
+		}
+
+		if ok, done := d.readField(header); done {
+			return ok
+		}
+	}
+}
+
+// readField reads the field opened by header. It returns done as false when the field
+// had an error that was recorded so reading can continue with the next field.
+func (d *Decoder) readField(header line) (ok bool, done bool) {
+	if d.indent == -1 {
+		d.indent = header.indent()
+	}
+	if header.indent() > d.indent {
+		text := strings.TrimSpace(header.text)
+		return d.skipField(header, &SyntaxError{Position: Position{Line: header.num, Column: header.indent() + 1}, Text: text, Msg: "unexpected indentation"})
+	}
+
+	name, size, valueStr, err := parseFieldHeader(header)
+	if err != nil {
+		return d.skipField(header, err)
+	}
+
+	fieldType, exists := d.schema.Fields[name]
+	if !exists {
+		return d.skipField(header, unknownField(header, name))
+	}
+
+	if d.seen == nil {
+		d.seen = make(map[string]bool)
+	}
+	d.seen[name] = true
+
+	if fieldType.Type == "array" && !(size == -1 && isNull(fieldType, valueStr)) {
+		state := &arrayState{
+			name:      name,
+			fieldType: fieldType,
+			declared:  size,
+			indent:    header.indent(),
+			line:      header.num,
+		}
+		if valueStr != "" {
+			state.isInline = true
+			state.inline, err = parseInlineArray(fieldType, valueStr, valueColumn(header, valueStr), size)
+			if err != nil {
+				return d.skipField(header, annotate(err, name, header.num, 0))
+			}
+		}
+		d.array = state
+		d.token = Token{Kind: ArrayStartToken, Name: name, Len: size}
+		return true, true
+	}
+
+	if size != -1 {
+		return d.skipField(header, annotate(nonArraySize(header), name, 0, 0))
+	}
+
+	body := d.lines.readBlock(header.indent())
+	value, err := parseFieldValue(fieldType, header, valueStr, body)
+	if err != nil {
+		if !d.report(annotate(err, name, header.num, 0)) {
+			return false, true
+		}
+		return false, false
+	}
+
+	d.token = Token{Kind: FieldToken, Name: name, Value: value}
+	return true, true
+}
+
+// skipField reports err and, when collecting errors, skips the lines nested below header
+func (d *Decoder) skipField(header line, err error) (ok bool, done bool) {
+	if !d.report(err) {
+		return false, true
+	}
+	d.lines.readBlock(header.indent())
+	return false, false
+}
+
+// nextElement returns the next element of the current array, or closes the array.
+// When collecting errors, elements with errors are reported and skipped.
+func (d *Decoder) nextElement() bool {
+	state := d.array
+
+	if state.isInline {
+		if state.count == len(state.inline) {
+			return d.endArray()
+		}
+		d.token = Token{Kind: ElementToken, Name: state.name, Index: state.count, Value: state.inline[state.count]}
+		state.count++
+		return true
+	}
+
+	for {
+		l, ok := d.lines.peek()
+		for ok && l.blank() {
+			d.lines.next()
+			l, ok = d.lines.peek()
+		}
+		if !ok || l.indent() <= state.indent {
+			if d.lines.err != nil {
+				return d.fail(d.lines.err)
+			}
+			return d.endArray()
+		}
+
+		d.lines.next()
+		body := d.lines.readBlock(l.indent())
+
+		if state.declared >= 0 && state.count == state.declared {
+			// Count the remaining elements so the error reports the actual size
+			found := state.count + 1
+			for {
+				next, ok := d.lines.peek()
+				if !ok || (!next.blank() && next.indent() <= state.indent) {
+					break
+				}
+				d.lines.next()
+				d.lines.readBlock(next.indent())
+				if !next.blank() {
+					found++
+				}
+			}
+			if !d.report(annotate(sizeMismatch(state.line, state.declared, found), state.name, 0, 0)) {
+				return false
+			}
+			// The mismatch has been reported, so the array can close normally
+			state.declared = -1
+			return d.endArray()
+		}
+
+		index := state.count
+		state.count++
+		elem, err := parseElement(state.fieldType, index, l, body)
+		if err != nil {
+			if !d.report(annotate(err, state.name, 0, 0)) {
+				return false
+			}
+			continue
+		}
+
+		d.token = Token{Kind: ElementToken, Name: state.name, Index: index, Value: elem}
+		return true
+	}
+}
+
+// endArray validates the element count of the current array and emits its end token
+func (d *Decoder) endArray() bool {
+	state := d.array
+	if state.declared >= 0 && state.count != state.declared {
+		if !d.report(annotate(sizeMismatch(state.line, state.declared, state.count), state.name, 0, 0)) {
+			return false
+		}
+	}
+
+	d.array = nil
+	d.token = Token{Kind: ArrayEndToken, Name: state.name}
+	return true
+}
+
+// checkRequired reports the required fields that did not appear in the data section
+func (d *Decoder) checkRequired() {
+	for _, name := range d.schema.GetFieldOrder() {
+		if d.schema.Fields[name].Required && !d.seen[name] {
+			if !d.report(&SchemaError{Position: Position{Path: name}, Msg: "missing required field"}) {
+				return
+			}
+		}
+	}
+}
+
+// nextContentLine skips blank lines and returns the next line with content
+func (d *Decoder) nextContentLine() (line, bool) {
+	for {
+		l, ok := d.lines.next()
+		if !ok {
+			if d.lines.err != nil {
+				d.fail(d.lines.err)
+			}
+			return line{}, false
+		}
+		if !l.blank() {
+			return l, true
+		}
+	}
+}
+
+// report records an error in the data. When collecting errors it returns true so the
+// Decoder can continue after the offending field or element; otherwise it stops the Decoder.
+func (d *Decoder) report(err error) bool {
+	if !d.collect {
+		return d.fail(err)
+	}
+	d.errs = append(d.errs, err)
+	return true
+}
+
+// fail records err and stops the Decoder
+func (d *Decoder) fail(err error) bool {
+	if d.collect {
+		d.errs = append(d.errs, err)
+		err = d.errs
+	}
+	d.err = err
+	d.token = Token{}
+	return false
+}
+
+// decodeAll reads every remaining token into a map of field values
+func decodeAll(dec *Decoder) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	var arr []interface{}
+
+	for dec.Next() {
+		tok := dec.Token()
+		switch tok.Kind {
+		case FieldToken:
+			result[tok.Name] = tok.Value
+		case ArrayStartToken:
+			// Cap preallocation so a bogus declared size cannot exhaust memory
+			capacity := tok.Len
+			if capacity < 0 || capacity > 1024 {
+				capacity = 1024
+			}
+			arr = make([]interface{}, 0, capacity)
+		case ElementToken:
+			arr = append(arr, tok.Value)
+		case ArrayEndToken:
+			result[tok.Name] = arr
+		}
+	}
+
+	// When collecting errors, the fields read without errors are returned with the errors
+	err := dec.Err()
+	if err != nil && !(dec.collect && dec.hasSchema) {
+		return nil, err
+	}
+	return result, err
+}
+
+// decodeDocument reads every remaining token and returns the document root: a map of
+// field values, or the records of an array document
+func decodeDocument(dec *Decoder) (interface{}, error) {
+	result, err := decodeAll(dec)
+	if result == nil {
+		return nil, err
+	}
+	if !dec.schema.IsArray() {
+		return result, err
+	}
+
+	records, ok := result[arrayDocumentField].([]interface{})
+	if !ok {
+		records = []interface{}{}
+	}
+	return records, err
+}
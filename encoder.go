@@ -0,0 +1,293 @@
+package metadat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Encoder writes a MetaDat document to an io.Writer incrementally.
+// Scalar and object fields are written with WriteField, while large arrays can be
+// streamed one element at a time with BeginArray, WriteElement and EndArray.
+//
+//	enc := metadat.NewEncoder(file, schema)
+//	enc.WriteField("name", "export")
+//	enc.BeginArray("rows", len(ids))
+//	for _, id := range ids {
+//	    enc.WriteElement(loadRow(id))
+//	}
+//	enc.EndArray()
+//	enc.Close()
+type Encoder struct {
+	out           *bufio.Writer
+	schema        Schema
+	writer        *Writer
+	headerPending bool
+	array         *encoderArray
+	err           error
+}
+
+// encoderArray tracks the array field currently being streamed
+type encoderArray struct {
+	name      string
+	fieldType FieldType
+	declared  int // declared size, -1 when elements are spooled until EndArray
+	count     int
+	inline    bool          // simple-type elements are written on the header line
+	simple    bool          // elements are of a simple type
+	spool     *os.File      // temporary storage for elements of an undeclared size
+	out       *bufio.Writer // destination of element output
+}
+
+// NewEncoder creates an Encoder writing a complete MetaDat document with meta and data sections
+func NewEncoder(w io.Writer, schema Schema) *Encoder {
+	encoder := NewDataEncoder(w, schema)
+	encoder.headerPending = true
+	return encoder
+}
+
+// NewDataEncoder creates an Encoder writing only the data section, as used in separated files mode
+func NewDataEncoder(w io.Writer, schema Schema) *Encoder {
+	return &Encoder{
+		out:    bufio.NewWriter(w),
+		schema: schema,
+		writer: &Writer{schema: schema},
+	}
+}
+
+// WriteField writes a complete field value, including whole arrays
+func (e *Encoder) WriteField(name string, value interface{}) error {
+	fieldType, err := e.prepare(name)
+	if err != nil {
+		return err
+	}
+
+	fieldStr, err := e.writer.writeField(name, value, fieldType, 0)
+	if err != nil {
+		return e.fail(fmt.Errorf("error writing field %s: %v", name, err))
+	}
+
+	e.out.WriteString(fieldStr)
+	if !strings.HasSuffix(fieldStr, "\n") {
+		e.out.WriteString("\n")
+	}
+	return nil
+}
+
+// BeginArray starts streaming the array field name with n elements.
+// When n is negative the element count is not known in advance: elements are
+// spooled to a temporary file and the "name[N]:" header is written by EndArray.
+// Simple-type elements are written inline unless there are more than maxInlineElements.
+func (e *Encoder) BeginArray(name string, n int) error {
+	fieldType, err := e.prepare(name)
+	if err != nil {
+		return err
+	}
+	if fieldType.Type != "array" {
+		return e.fail(fmt.Errorf("field %s is not an array", name))
+	}
+
+	state := &encoderArray{
+		name:      name,
+		fieldType: fieldType,
+		declared:  n,
+		inline:    n >= 0 && inlineArray(fieldType, n),
+		simple:    inlineArray(fieldType, 0),
+		out:       e.out,
+	}
+
+	if n < 0 {
+		spool, err := os.CreateTemp("", "metadat-array-*")
+		if err != nil {
+			return e.fail(fmt.Errorf("failed to create spool file for field %s: %v", name, err))
+		}
+		state.spool = spool
+		state.out = bufio.NewWriter(spool)
+	} else {
+		e.writeArrayHeader(state, n)
+	}
+
+	e.array = state
+	return nil
+}
+
+// WriteElement writes the next element of the array opened by BeginArray
+func (e *Encoder) WriteElement(v interface{}) error {
+	if e.err != nil {
+		return e.err
+	}
+	state := e.array
+	if state == nil {
+		return e.fail(fmt.Errorf("WriteElement called without BeginArray"))
+	}
+	if state.declared >= 0 && state.count == state.declared {
+		return e.fail(fmt.Errorf("error writing field %s: array size mismatch: declared %d, got more elements", state.name, state.declared))
+	}
+
+	if state.inline {
+		if state.count == 0 {
+			state.out.WriteString(" ")
+		} else {
+			state.out.WriteString("|")
+		}
+		value, err := formatInlineValue(v, state.fieldType.ElementType)
+		if err != nil {
+			return e.fail(fmt.Errorf("error writing field %s: element %d: %v", state.name, state.count, err))
+		}
+		state.out.WriteString(value)
+	} else {
+		itemStr, err := e.writer.writeArrayItem(v, state.fieldType.ElementType, 1)
+		if err != nil {
+			return e.fail(fmt.Errorf("error writing field %s: element %d: %v", state.name, state.count, err))
+		}
+		state.out.WriteString(itemStr)
+		state.out.WriteString("\n")
+	}
+
+	state.count++
+	return nil
+}
+
+// EndArray finishes the array opened by BeginArray, checking the declared element count
+func (e *Encoder) EndArray() error {
+	if e.err != nil {
+		return e.err
+	}
+	state := e.array
+	if state == nil {
+		return e.fail(fmt.Errorf("EndArray called without BeginArray"))
+	}
+	e.array = nil
+
+	if state.spool != nil {
+		defer os.Remove(state.spool.Name())
+		defer state.spool.Close()
+
+		if err := state.out.Flush(); err != nil {
+			return e.fail(fmt.Errorf("failed to spool field %s: %v", state.name, err))
+		}
+		// Spooled simple-type elements are one per line, and are joined if the array is short
+		state.inline = state.simple && inlineArray(state.fieldType, state.count)
+		e.writeArrayHeader(state, state.count)
+		if _, err := state.spool.Seek(0, io.SeekStart); err != nil {
+			return e.fail(fmt.Errorf("failed to spool field %s: %v", state.name, err))
+		}
+		var err error
+		if state.inline {
+			err = e.joinSpool(state)
+		} else {
+			_, err = io.Copy(e.out, state.spool)
+		}
+		if err != nil {
+			return e.fail(fmt.Errorf("failed to spool field %s: %v", state.name, err))
+		}
+	} else if state.count != state.declared {
+		return e.fail(fmt.Errorf("error writing field %s: array size mismatch: declared %d, found %d elements", state.name, state.declared, state.count))
+	}
+
+	if state.inline || state.count == 0 {
+		e.out.WriteString("\n")
+	}
+	return nil
+}
+
+// Flush writes any buffered output to the underlying writer
+func (e *Encoder) Flush() error {
+	if e.err != nil {
+		return e.err
+	}
+	if err := e.out.Flush(); err != nil {
+		return e.fail(err)
+	}
+	return nil
+}
+
+// Close finishes the document and flushes it. It does not close the underlying writer.
+func (e *Encoder) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	if e.array != nil {
+		return e.fail(fmt.Errorf("array field %s was not ended", e.array.name))
+	}
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	return e.Flush()
+}
+
+// prepare checks that a new field may be written and returns its type
+func (e *Encoder) prepare(name string) (FieldType, error) {
+	if e.err != nil {
+		return FieldType{}, e.err
+	}
+	if e.array != nil {
+		return FieldType{}, e.fail(fmt.Errorf("array field %s was not ended", e.array.name))
+	}
+	if err := e.writeHeader(); err != nil {
+		return FieldType{}, err
+	}
+
+	fieldType, exists := e.schema.Fields[name]
+	if !exists {
+		return FieldType{}, e.fail(fmt.Errorf("unknown field: %s", name))
+	}
+	return fieldType, nil
+}
+
+// writeHeader writes the meta section before the first field
+func (e *Encoder) writeHeader() error {
+	if len(e.schema.Fields) == 0 {
+		return e.fail(fmt.Errorf("no schema defined"))
+	}
+	if !e.headerPending {
+		return nil
+	}
+	e.headerPending = false
+
+	e.out.WriteString("meta\n")
+	e.out.WriteString(e.schema.ToString())
+	e.out.WriteString("\ndata\n")
+	return nil
+}
+
+// writeArrayHeader writes the "name[N]:" line that opens an array field
+func (e *Encoder) writeArrayHeader(state *encoderArray, n int) {
+	e.out.WriteString(fmt.Sprintf("%s[%d]:", state.name, n))
+	if !state.inline && n > 0 {
+		e.out.WriteString("\n")
+	}
+}
+
+// joinSpool writes the spooled elements of a short simple-type array inline, as WriteElement
+// would have written them had the size been declared
+func (e *Encoder) joinSpool(state *encoderArray) error {
+	spool := bufio.NewReader(state.spool)
+	for i := 0; i < state.count; i++ {
+		element, err := spool.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			e.out.WriteString(" ")
+		} else {
+			e.out.WriteString("|")
+		}
+		e.out.WriteString(strings.TrimSpace(element))
+	}
+	return nil
+}
+
+// fail records err and stops the Encoder
+func (e *Encoder) fail(err error) error {
+	e.err = err
+	// The array can no longer be ended, so its spool file is not needed
+	if e.array != nil && e.array.spool != nil {
+		e.array.spool.Close()
+		os.Remove(e.array.spool.Name())
+		e.array.spool = nil
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package metadat
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// parseEnumType parses the pipe-separated values of an enum(a|b|c) type
+func parseEnumType(valuesStr string) (FieldType, error) {
+	values := strings.Split(valuesStr, "|")
+	seen := make(map[string]bool, len(values))
+	for i, value := range values {
+		value = strings.TrimSpace(value)
+		if !isEnumSymbol(value) {
+			return FieldType{}, fmt.Errorf("invalid enum value: %q", value)
+		}
+		if seen[value] {
+			return FieldType{}, fmt.Errorf("duplicate enum value: %s", value)
+		}
+		seen[value] = true
+		values[i] = value
+	}
+	return FieldType{Type: "enum", EnumValues: values}, nil
+}
+
+// isEnumSymbol reports whether s can be used as an enum value. Values are written without
+// quotes, so they cannot be null or contain whitespace, delimiters or brackets.
+func isEnumSymbol(s string) bool {
+	if s == "" || s == "null" || needsQuoting(s) {
+		return false
+	}
+	return !strings.ContainsAny(s, " \t(),:?!")
+}
+
+// enumIndex returns the position of value among the values of an enum type, or -1
+func enumIndex(fieldType FieldType, value string) int {
+	for i, v := range fieldType.EnumValues {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseEnumValue checks that the text of a value is one of the values of its enum type
+func parseEnumValue(fieldType FieldType, valueStr string) (string, error) {
+	if enumIndex(fieldType, valueStr) == -1 {
+		return "", fmt.Errorf("invalid enum value: %s, expected one of %s", valueStr, strings.Join(fieldType.EnumValues, "|"))
+	}
+	return valueStr, nil
+}
+
+// toEnumValue converts an enum value, or its position among the enum values, into the value
+func toEnumValue(value interface{}, fieldType FieldType) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return parseEnumValue(fieldType, v)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		negative, index, _ := integerParts(v)
+		if negative || index >= uint64(len(fieldType.EnumValues)) {
+			return "", fmt.Errorf("enum index %v out of range for %s", v, fieldTypeToString(fieldType))
+		}
+		return fieldType.EnumValues[index], nil
+	default:
+		return "", fmt.Errorf("expected enum value, got %T", value)
+	}
+}
+
+// assignEnum stores an enum value into a type implementing encoding.TextUnmarshaler, a
+// string type, or an integer type as the position of the value among the enum values
+func assignEnum(dst reflect.Value, src interface{}, fieldType FieldType, path string) error {
+	value, err := toEnumValue(src, fieldType)
+	if err != nil {
+		return fmt.Errorf("%s: %v", describePath(path), err)
+	}
+
+	if dst.CanAddr() && dst.Addr().Type().Implements(textUnmarshalerType) {
+		if err := dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("cannot unmarshal %s: %v", describePath(path), err)
+		}
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.String:
+		dst.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		index := int64(enumIndex(fieldType, value))
+		if dst.OverflowInt(index) {
+			return fmt.Errorf("value %d overflows Go type %s for %s", index, dst.Type(), describePath(path))
+		}
+		dst.SetInt(index)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		index := uint64(enumIndex(fieldType, value))
+		if dst.OverflowUint(index) {
+			return fmt.Errorf("value %d overflows Go type %s for %s", index, dst.Type(), describePath(path))
+		}
+		dst.SetUint(index)
+	default:
+		return assignError(fieldType, dst.Type(), path)
+	}
+	return nil
+}
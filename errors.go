@@ -0,0 +1,139 @@
+package metadat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Position locates an error in a MetaDat document
+type Position struct {
+	Line   int    // line number, starting at 1; 0 when not known
+	Column int    // column of the offending text, starting at 1; 0 when not known
+	Path   string // path of the field, such as orders[3].total; empty for the document itself
+}
+
+// position gives annotate access to the Position embedded in an error
+func (p *Position) position() *Position {
+	return p
+}
+
+// SyntaxError reports MetaDat text that cannot be parsed
+type SyntaxError struct {
+	Position
+	Text string // offending text
+	Msg  string // description of the problem
+}
+
+func (e *SyntaxError) Error() string {
+	return formatPositionError(e.Position, e.Msg)
+}
+
+// TypeError reports a value that cannot be converted to its schema type
+type TypeError struct {
+	Position
+	Text string // offending text
+	Type string // schema type of the value
+	Msg  string // description of the problem
+}
+
+func (e *TypeError) Error() string {
+	return formatPositionError(e.Position, e.Msg)
+}
+
+// SchemaError reports a meta section that cannot be parsed, or data whose structure does not
+// match the schema: unknown fields, missing required fields and array size mismatches
+type SchemaError struct {
+	Position
+	Text string // offending text
+	Msg  string // description of the problem
+}
+
+func (e *SchemaError) Error() string {
+	return formatPositionError(e.Position, e.Msg)
+}
+
+// formatPositionError writes msg prefixed with the position and path it applies to
+func formatPositionError(p Position, msg string) string {
+	var b strings.Builder
+	if p.Line > 0 {
+		b.WriteString(fmt.Sprintf("line %d", p.Line))
+		if p.Column > 0 {
+			b.WriteString(fmt.Sprintf(", column %d", p.Column))
+		}
+		b.WriteString(": ")
+	}
+	if p.Path != "" {
+		b.WriteString(describePath(p.Path))
+		b.WriteString(": ")
+	}
+	b.WriteString(msg)
+	return b.String()
+}
+
+// annotate adds context to a structured error as it is returned from nested values: segment
+// (a field name or an "[index]") is prepended to its path, and the line and column are filled
+// in when they are not known yet. Other errors are returned unchanged.
+func annotate(err error, segment string, line, column int) error {
+	var positioned interface{ position() *Position }
+	if !errors.As(err, &positioned) {
+		return err
+	}
+
+	pos := positioned.position()
+	if segment != "" {
+		pos.Path = joinSegment(segment, pos.Path)
+	}
+	if pos.Line == 0 {
+		pos.Line = line
+	}
+	if pos.Column == 0 {
+		pos.Column = column
+	}
+	return err
+}
+
+// joinSegment prepends a field name or "[index]" segment to a field path
+func joinSegment(segment, path string) string {
+	if path == "" {
+		return segment
+	}
+	if strings.HasPrefix(path, "[") {
+		return segment + path
+	}
+	return segment + "." + path
+}
+
+// elementSegment returns the path segment of the array element at index
+func elementSegment(index int) string {
+	return fmt.Sprintf("[%d]", index)
+}
+
+// ErrorList holds every error found by a Parser or Decoder collecting errors, in the order
+// they were found, or by Schema.ValidateAll
+type ErrorList []error
+
+// Error returns the first error, followed by the number of other errors
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	default:
+		return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+	}
+}
+
+// Unwrap returns the errors in the list, so errors.As and errors.Is examine each of them
+func (l ErrorList) Unwrap() []error {
+	return l
+}
+
+// Err returns the list as an error, or nil when it is empty
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
@@ -0,0 +1,564 @@
+package metadat
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// structField describes how a Go struct field maps onto a MetaDat field
+type structField struct {
+	name      string // MetaDat field name
+	index     []int  // index sequence for reflect.Value.FieldByIndex
+	typ       reflect.Type
+	omitEmpty bool   // omit zero values when writing data
+	required  bool   // field is marked required in the schema
+	typeName  string // explicit schema type from a `type=` tag option
+}
+
+// fieldTag holds the options of a `metadat` or `json` struct tag
+type fieldTag struct {
+	name      string
+	omitEmpty bool
+	required  bool
+	typeName  string
+}
+
+// parseFieldTag reads the tag options for a struct field. The `metadat` tag takes
+// precedence; the `json` tag supplies the name and omitempty when it is absent.
+// The second result is false when the field is excluded with "-".
+func parseFieldTag(sf reflect.StructField) (fieldTag, bool) {
+	var tag fieldTag
+
+	jsonTag, hasJSON := sf.Tag.Lookup("json")
+	if jsonTag == "-" {
+		if _, hasMetaDat := sf.Tag.Lookup("metadat"); !hasMetaDat {
+			return tag, false
+		}
+	}
+	if hasJSON && jsonTag != "-" {
+		parts := strings.Split(jsonTag, ",")
+		tag.name = parts[0]
+		for _, opt := range parts[1:] {
+			if opt == "omitempty" {
+				tag.omitEmpty = true
+			}
+		}
+	}
+
+	metadatTag, hasMetaDat := sf.Tag.Lookup("metadat")
+	if !hasMetaDat {
+		return tag, true
+	}
+	if metadatTag == "-" {
+		return tag, false
+	}
+
+	parts := splitTagOptions(metadatTag)
+	if parts[0] != "" {
+		tag.name = parts[0]
+	}
+	for _, opt := range parts[1:] {
+		switch {
+		case opt == "omitempty":
+			tag.omitEmpty = true
+		case opt == "required":
+			tag.required = true
+		case strings.HasPrefix(opt, "type="):
+			tag.typeName = strings.TrimPrefix(opt, "type=")
+		}
+	}
+
+	return tag, true
+}
+
+// splitTagOptions splits a tag on commas that are not nested inside a type expression,
+// so that `type=` options may themselves contain commas
+func splitTagOptions(tag string) []string {
+	var parts []string
+	var current strings.Builder
+	depth := 0
+
+	for _, ch := range tag {
+		switch ch {
+		case '{', '(', '<', '[':
+			depth++
+		case '}', ')', '>', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(current.String()))
+				current.Reset()
+				continue
+			}
+		}
+		current.WriteRune(ch)
+	}
+	parts = append(parts, strings.TrimSpace(current.String()))
+
+	return parts
+}
+
+// structFields returns the MetaDat-visible fields of a struct type in declaration order.
+// Field names follow the `metadat` tag, then the `json` tag, then the Go field name.
+// Untagged embedded structs are flattened into the parent, as encoding/json does.
+func structFields(t reflect.Type) []structField {
+	fields := make([]structField, 0, t.NumField())
+	seen := make(map[string]bool)
+
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			tag, ok := parseFieldTag(sf)
+			if !ok {
+				continue
+			}
+
+			fieldIndex := make([]int, len(index)+1)
+			copy(fieldIndex, index)
+			fieldIndex[len(index)] = i
+
+			if sf.Anonymous && tag.name == "" && tag.typeName == "" {
+				ft := sf.Type
+				if ft.Kind() == reflect.Pointer {
+					if !sf.IsExported() {
+						// Cannot allocate through an unexported embedded pointer
+						continue
+					}
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					walk(ft, fieldIndex)
+					continue
+				}
+			}
+			if !sf.IsExported() {
+				continue
+			}
+
+			name := tag.name
+			if name == "" {
+				name = sf.Name
+			}
+			// Outer fields take precedence over flattened embedded ones
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			fields = append(fields, structField{
+				name:      name,
+				index:     fieldIndex,
+				typ:       sf.Type,
+				omitEmpty: tag.omitEmpty,
+				required:  tag.required,
+				typeName:  tag.typeName,
+			})
+		}
+	}
+	walk(t, nil)
+
+	return fields
+}
+
+// lookupStructField finds the struct field for a MetaDat field name, preferring
+// an exact match and falling back to a case-insensitive one
+func lookupStructField(fields []structField, name string) (structField, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
+
+// fieldByIndex returns the struct field at index, allocating nil embedded pointers on the way
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// fieldValueByIndex returns the struct field at index without allocating, or an
+// invalid Value when a nil embedded pointer is in the way
+func fieldValueByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// implementsTextMarshaler reports whether values of t encode themselves as text
+func implementsTextMarshaler(t reflect.Type) bool {
+	return t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)
+}
+
+// goTypes infers FieldTypes from Go types. A struct type that contains itself, directly or
+// through other types, becomes a named type referred to by name, so inference ends.
+type goTypes struct {
+	visiting map[reflect.Type]bool   // struct types being inferred
+	names    map[reflect.Type]string // names given to recursive struct types
+	scope    typeScope               // definitions of the recursive struct types
+	order    []string                // names in the order they were given
+}
+
+// newGoTypes creates a goTypes with no types seen yet
+func newGoTypes() *goTypes {
+	return &goTypes{
+		visiting: make(map[reflect.Type]bool),
+		names:    make(map[reflect.Type]string),
+		scope:    make(typeScope),
+	}
+}
+
+// name returns the named type standing for the recursive struct type t, declaring it on
+// first use. Go type names that cannot be used as a named type are replaced by "Type".
+func (g *goTypes) name(t reflect.Type) string {
+	if name, exists := g.names[t]; exists {
+		return name
+	}
+	base := t.Name()
+	if checkTypeName(base) != nil {
+		base = "Type"
+	}
+	name := base
+	for i := 2; g.scope[name] != nil; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	g.names[t] = name
+	g.scope[name] = &FieldType{}
+	g.order = append(g.order, name)
+	return name
+}
+
+// resolve replaces the references to recursive struct types within fieldType and declares
+// those types as the named types of schema
+func (g *goTypes) resolve(schema *Schema, fieldType *FieldType) error {
+	if len(g.order) == 0 {
+		return nil
+	}
+	for _, name := range g.order {
+		if err := g.scope.resolve(g.scope[name]); err != nil {
+			return err
+		}
+	}
+	if err := g.scope.resolve(fieldType); err != nil {
+		return err
+	}
+
+	schema.Types = make(map[string]FieldType, len(g.order))
+	for _, name := range g.order {
+		schema.Types[name] = *g.scope[name]
+	}
+	schema.TypeOrder = g.order
+	return nil
+}
+
+// infer derives a FieldType from a Go type. The optional value is only consulted where
+// the type itself does not determine the schema: interface fields and maps without a
+// declared value type.
+func (g *goTypes) infer(t reflect.Type, v reflect.Value) (FieldType, error) {
+	if v.IsValid() && v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			v = reflect.Value{}
+		} else {
+			v = v.Elem()
+			t = v.Type()
+		}
+	}
+
+	switch t {
+	case timeType:
+		return FieldType{Type: "timestamp"}, nil
+	case durationType:
+		return FieldType{Type: "duration"}, nil
+	case decimalType:
+		return FieldType{Type: "decimal"}, nil
+	}
+	if isByteSequence(t) {
+		return FieldType{Type: "bytes"}, nil
+	}
+
+	if t.Kind() != reflect.Interface && t.Kind() != reflect.Pointer && implementsTextMarshaler(t) {
+		return FieldType{Type: "string"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		if v.IsValid() {
+			if v.IsNil() {
+				v = reflect.Value{}
+			} else {
+				v = v.Elem()
+			}
+		}
+		// A nil pointer is written as null
+		fieldType, err := g.infer(t.Elem(), v)
+		fieldType.Nullable = true
+		return fieldType, err
+
+	case reflect.Interface:
+		// No value to look at; fall back to the JSON inference default for null
+		return FieldType{Type: "string", Nullable: true}, nil
+
+	case reflect.String:
+		return FieldType{Type: "string"}, nil
+
+	case reflect.Bool:
+		return FieldType{Type: "bool"}, nil
+
+	case reflect.Int:
+		return FieldType{Type: "int"}, nil
+
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return FieldType{Type: strings.ToLower(t.Kind().String())}, nil
+
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return FieldType{Type: "uint64"}, nil
+
+	case reflect.Float32:
+		return FieldType{Type: "float32"}, nil
+
+	case reflect.Float64:
+		return FieldType{Type: "float64"}, nil
+
+	case reflect.Slice, reflect.Array:
+		var elemValue reflect.Value
+		if v.IsValid() && v.Len() > 0 {
+			elemValue = v.Index(0)
+		}
+		elementType, err := g.infer(t.Elem(), elemValue)
+		if err != nil {
+			return FieldType{}, err
+		}
+		return FieldType{Type: "array", ElementType: &elementType}, nil
+
+	case reflect.Struct:
+		// A struct type met again while it is inferred, or already known to be
+		// recursive, is referred to by name
+		if name, exists := g.names[t]; exists || g.visiting[t] {
+			if !exists {
+				name = g.name(t)
+			}
+			return FieldType{TypeName: name}, nil
+		}
+		g.visiting[t] = true
+		defer delete(g.visiting, t)
+
+		fields := structFields(t)
+		objectFields := make(map[string]FieldType, len(fields))
+		objectOrder := make([]string, 0, len(fields))
+		for _, sf := range fields {
+			var fieldValue reflect.Value
+			if v.IsValid() {
+				fieldValue = fieldValueByIndex(v, sf.index)
+			}
+			fieldType, err := g.inferField(sf, fieldValue)
+			if err != nil {
+				return FieldType{}, err
+			}
+			fieldType.Name = sf.name
+			fieldType.Required = sf.required
+			objectFields[sf.name] = fieldType
+			objectOrder = append(objectOrder, sf.name)
+		}
+		objectType := FieldType{Type: "object", ObjectFields: objectFields, ObjectOrder: objectOrder}
+		if name, recursive := g.names[t]; recursive {
+			*g.scope[name] = objectType
+			return FieldType{TypeName: name}, nil
+		}
+		return objectType, nil
+
+	case reflect.Map:
+		// Maps with string keys and a declared value type become map<string,T>
+		if t.Key().Kind() == reflect.String && t.Elem().Kind() != reflect.Interface {
+			var elemValue reflect.Value
+			if v.IsValid() && v.Len() > 0 {
+				iter := v.MapRange()
+				iter.Next()
+				elemValue = iter.Value()
+			}
+			valueType, err := g.infer(t.Elem(), elemValue)
+			if err != nil {
+				return FieldType{}, err
+			}
+			return FieldType{Type: "map", ElementType: &valueType}, nil
+		}
+
+		// Otherwise the keys are only known at runtime, so infer the object shape from the value
+		if !v.IsValid() || v.IsNil() {
+			return FieldType{Type: "object", ObjectFields: map[string]FieldType{}}, nil
+		}
+		return inferFieldType(toGeneric(v)), nil
+
+	default:
+		return FieldType{}, fmt.Errorf("unsupported Go type %s", t)
+	}
+}
+
+// inferField derives the FieldType of a struct field, honouring a `type=` tag option
+func (g *goTypes) inferField(sf structField, v reflect.Value) (FieldType, error) {
+	if sf.typeName != "" {
+		fieldType, err := parseType(sf.typeName)
+		if err != nil {
+			return FieldType{}, fmt.Errorf("invalid type tag for field %s: %v", sf.name, err)
+		}
+		return fieldType, nil
+	}
+
+	fieldType, err := g.infer(sf.typ, v)
+	if err != nil {
+		return FieldType{}, fmt.Errorf("field %s: %v", sf.name, err)
+	}
+	return fieldType, nil
+}
+
+// toGeneric converts a Go value into the generic representation used by the writer:
+// structs and maps become map[string]interface{}, slices become []interface{}, and
+// scalars keep a Go type matching the schema type inferred for them
+func toGeneric(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+
+	// Temporal values are formatted by the writer according to their schema type
+	if v.Type() == timeType || v.Type() == durationType || v.Type() == decimalType {
+		return v.Interface()
+	}
+	if isByteSequence(v.Type()) {
+		// The schema declares bytes as non-nullable, so a nil slice is written as empty
+		data := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(data), v)
+		return data
+	}
+
+	if v.Kind() != reflect.Interface && v.Kind() != reflect.Pointer && implementsTextMarshaler(v.Type()) {
+		marshaler, ok := v.Interface().(encoding.TextMarshaler)
+		if !ok && v.CanAddr() {
+			marshaler, ok = v.Addr().Interface().(encoding.TextMarshaler)
+		}
+		if ok {
+			if text, err := marshaler.MarshalText(); err == nil {
+				return string(text)
+			}
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return toGeneric(v.Elem())
+
+	case reflect.String:
+		return v.String()
+
+	case reflect.Bool:
+		return v.Bool()
+
+	case reflect.Int:
+		return int(v.Int())
+
+	case reflect.Int8:
+		return int8(v.Int())
+
+	case reflect.Int16:
+		return int16(v.Int())
+
+	case reflect.Int32:
+		return int32(v.Int())
+
+	case reflect.Int64:
+		return v.Int()
+
+	case reflect.Uint8:
+		return uint8(v.Uint())
+
+	case reflect.Uint16:
+		return uint16(v.Uint())
+
+	case reflect.Uint32:
+		return uint32(v.Uint())
+
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return v.Uint()
+
+	case reflect.Float32:
+		return float32(v.Float())
+
+	case reflect.Float64:
+		return v.Float()
+
+	case reflect.Slice, reflect.Array:
+		result := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			result[i] = toGeneric(v.Index(i))
+		}
+		return result
+
+	case reflect.Struct:
+		fields := structFields(v.Type())
+		result := make(map[string]interface{}, len(fields))
+		for _, sf := range fields {
+			fieldValue := fieldValueByIndex(v, sf.index)
+			if !fieldValue.IsValid() || (sf.omitEmpty && isEmptyValue(fieldValue)) {
+				continue
+			}
+			result[sf.name] = toGeneric(fieldValue)
+		}
+		return result
+
+	case reflect.Map:
+		result := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			result[fmt.Sprint(iter.Key().Interface())] = toGeneric(iter.Value())
+		}
+		return result
+
+	default:
+		return v.Interface()
+	}
+}
+
+// isEmptyValue reports whether v is empty for the purposes of omitempty, matching encoding/json
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
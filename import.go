@@ -0,0 +1,168 @@
+package metadat
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Loader loads the schema files named by import directives in a meta section. Names are
+// slash-separated paths; relative imports have already been resolved against the
+// directory of the importing file.
+type Loader interface {
+	Load(name string) ([]byte, error)
+}
+
+// LoaderFunc adapts an ordinary function to the Loader interface
+type LoaderFunc func(name string) ([]byte, error)
+
+// Load calls f(name)
+func (f LoaderFunc) Load(name string) ([]byte, error) {
+	return f(name)
+}
+
+// FileLoader returns a Loader that reads imports from the operating system's file system,
+// relative to the current directory. It is the default Loader of schema files read by
+// ParseFromFiles; documents parsed from strings or readers cannot import without SetLoader.
+func FileLoader() Loader {
+	return LoaderFunc(func(name string) ([]byte, error) {
+		return os.ReadFile(filepath.FromSlash(name))
+	})
+}
+
+// FSLoader returns a Loader that reads imports from fsys, such as an embed.FS or os.DirFS
+func FSLoader(fsys fs.FS) Loader {
+	return LoaderFunc(func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, name)
+	})
+}
+
+// MapLoader returns a Loader that reads imports from memory, keyed by name
+func MapLoader(files map[string]string) Loader {
+	return LoaderFunc(func(name string) ([]byte, error) {
+		content, exists := files[name]
+		if !exists {
+			return nil, fmt.Errorf("schema file not found: %s", name)
+		}
+		return []byte(content), nil
+	})
+}
+
+// importer follows the import directives of a meta section and of the files it imports
+type importer struct {
+	loader Loader
+	chain  []string          // files being imported, the outermost first
+	loaded map[string]Schema // schema of each file imported so far
+}
+
+// noLoader rejects every import, so that parsing a document does not read files unless the
+// caller has chosen a Loader
+var noLoader = LoaderFunc(func(name string) ([]byte, error) {
+	return nil, fmt.Errorf("imports are not enabled, set a Loader to read %s", name)
+})
+
+// newImporter creates an importer for the meta section of file, or of a document that was
+// not read from a file when file is empty. Without a loader, only the imports of a file are
+// read, from the file system.
+func newImporter(loader Loader, file string) *importer {
+	if loader == nil {
+		loader = noLoader
+		if file != "" {
+			loader = FileLoader()
+		}
+	}
+	imports := &importer{loader: loader, loaded: make(map[string]Schema)}
+	if file != "" {
+		imports.chain = []string{path.Clean(filepath.ToSlash(file))}
+	}
+	return imports
+}
+
+// parseImportDirective returns the path of an `import "path"` line of the meta section. It
+// reports false for lines that are not import directives.
+func parseImportDirective(text string) (name string, ok bool, err error) {
+	rest, found := strings.CutPrefix(text, "import ")
+	if !found {
+		return "", false, nil
+	}
+	rest = strings.TrimSpace(rest)
+	name, err = strconv.Unquote(rest)
+	if err != nil || !strings.HasPrefix(rest, `"`) || name == "" {
+		return "", true, fmt.Errorf("invalid import: %s", rest)
+	}
+	return name, true, nil
+}
+
+// resolve returns the name of an imported file, relative imports being taken from the
+// directory of the importing file
+func (imports *importer) resolve(name string) string {
+	if path.IsAbs(name) || len(imports.chain) == 0 {
+		return path.Clean(name)
+	}
+	return path.Join(path.Dir(imports.chain[len(imports.chain)-1]), name)
+}
+
+// load parses an imported file, returning its resolved name and schema. Only the named
+// types the schema declares are taken from it; types it imports itself are not passed on.
+func (imports *importer) load(name string) (string, Schema, error) {
+	name = imports.resolve(name)
+	for i, file := range imports.chain {
+		if file == name {
+			cycle := append(append([]string{}, imports.chain[i:]...), name)
+			return name, Schema{}, fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	if schema, exists := imports.loaded[name]; exists {
+		return name, schema, nil
+	}
+
+	content, err := imports.loader.Load(name)
+	if err != nil {
+		return name, Schema{}, err
+	}
+	imports.chain = append(imports.chain, name)
+	schema, errs := parseSchemaAll(string(content), imports)
+	imports.chain = imports.chain[:len(imports.chain)-1]
+	if len(errs) > 0 {
+		return name, Schema{}, errs[0]
+	}
+
+	imports.loaded[name] = schema
+	return name, schema, nil
+}
+
+// importTypes adds the named types declared by an imported file to scope, recording in
+// origins the file each of them comes from. A file imported more than once, directly or
+// through other imports, adds its types only once.
+func importTypes(imports *importer, name string, scope typeScope, origins map[string]string) error {
+	file, schema, err := imports.load(name)
+	if err != nil {
+		return err
+	}
+	for _, typeName := range schema.TypeOrder {
+		if _, exists := scope[typeName]; exists {
+			if origins[typeName] == file {
+				continue
+			}
+			return errors.New(duplicateType(typeName, origins[typeName]))
+		}
+		definition := schema.Types[typeName]
+		scope[typeName] = &definition
+		origins[typeName] = file
+	}
+	return nil
+}
+
+// duplicateType describes a named type declared twice, origin being the file the first
+// declaration was imported from, or empty when it is declared in the same meta section
+func duplicateType(name, origin string) string {
+	if origin == "" {
+		return "duplicate type: " + name
+	}
+	return fmt.Sprintf("duplicate type: %s, already imported from %s", name, origin)
+}
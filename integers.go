@@ -0,0 +1,202 @@
+package metadat
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// isIntegerType reports whether a schema type holds whole numbers
+func isIntegerType(t string) bool {
+	switch t {
+	case "int", "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64":
+		return true
+	}
+	return false
+}
+
+// integerRange returns the magnitude of the smallest and the largest value of an integer
+// type. The int type has the size of a Go int.
+func integerRange(t string) (minMagnitude uint64, max uint64) {
+	switch t {
+	case "int8":
+		return 1 << 7, math.MaxInt8
+	case "int16":
+		return 1 << 15, math.MaxInt16
+	case "int32":
+		return 1 << 31, math.MaxInt32
+	case "int64":
+		return 1 << 63, math.MaxInt64
+	case "uint8":
+		return 0, math.MaxUint8
+	case "uint16":
+		return 0, math.MaxUint16
+	case "uint32":
+		return 0, math.MaxUint32
+	case "uint64":
+		return 0, math.MaxUint64
+	default:
+		return math.MaxInt + 1, math.MaxInt
+	}
+}
+
+// parseIntegerValue converts the text of an integer value, checking it against the range
+// of the declared type
+func parseIntegerValue(fieldType FieldType, valueStr string) (interface{}, error) {
+	digits, negative := strings.CutPrefix(valueStr, "-")
+	if !negative {
+		digits = strings.TrimPrefix(digits, "+")
+	}
+
+	magnitude, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return nil, fmt.Errorf("value %s out of range for %s", valueStr, fieldType.Type)
+		}
+		return nil, fmt.Errorf("invalid integer value: %s", valueStr)
+	}
+	return makeInteger(fieldType.Type, negative, magnitude)
+}
+
+// toIntegerValue converts a Go integer, or a float64 holding a whole number as decoded from
+// JSON, into the Go type of an integer schema type
+func toIntegerValue(value interface{}, fieldType FieldType) (interface{}, error) {
+	negative, magnitude, err := integerParts(value)
+	if err != nil {
+		return nil, err
+	}
+	return makeInteger(fieldType.Type, negative, magnitude)
+}
+
+// integerParts splits a Go integer, or a float64 holding a whole number, into its sign
+// and magnitude
+func integerParts(value interface{}) (negative bool, magnitude uint64, err error) {
+	switch v := value.(type) {
+	case int:
+		return splitInt(int64(v))
+	case int8:
+		return splitInt(int64(v))
+	case int16:
+		return splitInt(int64(v))
+	case int32:
+		return splitInt(int64(v))
+	case int64:
+		return splitInt(v)
+	case uint:
+		return false, uint64(v), nil
+	case uint8:
+		return false, uint64(v), nil
+	case uint16:
+		return false, uint64(v), nil
+	case uint32:
+		return false, uint64(v), nil
+	case uint64:
+		return false, v, nil
+	case float64:
+		if v != math.Trunc(v) {
+			return false, 0, fmt.Errorf("value %v is not an integer", v)
+		}
+		if math.Abs(v) >= 1<<64 {
+			return false, 0, fmt.Errorf("value %v out of range for an integer", v)
+		}
+		if v < 0 {
+			return true, uint64(-v), nil
+		}
+		return false, uint64(v), nil
+	default:
+		return false, 0, fmt.Errorf("expected integer, got %T", value)
+	}
+}
+
+// splitInt splits a signed integer into its sign and magnitude
+func splitInt(n int64) (bool, uint64, error) {
+	if n < 0 {
+		return true, -uint64(n), nil
+	}
+	return false, uint64(n), nil
+}
+
+// makeInteger builds the Go value of an integer type from a sign and magnitude, reporting
+// values outside the range of the type
+func makeInteger(t string, negative bool, magnitude uint64) (interface{}, error) {
+	if magnitude == 0 {
+		negative = false
+	}
+	minMagnitude, max := integerRange(t)
+	if (negative && magnitude > minMagnitude) || (!negative && magnitude > max) {
+		text := strconv.FormatUint(magnitude, 10)
+		if negative {
+			text = "-" + text
+		}
+		return nil, fmt.Errorf("value %s out of range for %s", text, t)
+	}
+
+	// Two's complement negation wraps correctly for the smallest value of each type
+	n := int64(magnitude)
+	if negative {
+		n = int64(-magnitude)
+	}
+	switch t {
+	case "int8":
+		return int8(n), nil
+	case "int16":
+		return int16(n), nil
+	case "int32":
+		return int32(n), nil
+	case "int64":
+		return n, nil
+	case "uint8":
+		return uint8(magnitude), nil
+	case "uint16":
+		return uint16(magnitude), nil
+	case "uint32":
+		return uint32(magnitude), nil
+	case "uint64":
+		return magnitude, nil
+	default:
+		return int(n), nil
+	}
+}
+
+// formatIntegerValue writes an integer value, checking it against the range of its type
+func formatIntegerValue(value interface{}, fieldType FieldType) (string, error) {
+	v, err := toIntegerValue(value, fieldType)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d", v), nil
+}
+
+// assignInteger stores a parsed integer value into a Go integer or float type
+func assignInteger(dst reflect.Value, src interface{}, fieldType FieldType, path string) error {
+	negative, magnitude, err := integerParts(src)
+	if err != nil {
+		return fmt.Errorf("%s: %v", describePath(path), err)
+	}
+
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := makeInteger("int64", negative, magnitude)
+		if err != nil || dst.OverflowInt(n.(int64)) {
+			return fmt.Errorf("value %v overflows Go type %s for %s", src, dst.Type(), describePath(path))
+		}
+		dst.SetInt(n.(int64))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if negative || dst.OverflowUint(magnitude) {
+			return fmt.Errorf("value %v overflows Go type %s for %s", src, dst.Type(), describePath(path))
+		}
+		dst.SetUint(magnitude)
+	case reflect.Float32, reflect.Float64:
+		f := float64(magnitude)
+		if negative {
+			f = -f
+		}
+		dst.SetFloat(f)
+	default:
+		return assignError(fieldType, dst.Type(), path)
+	}
+	return nil
+}
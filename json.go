@@ -0,0 +1,198 @@
+package metadat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonObject is a decoded JSON object that remembers the source order of its keys
+type jsonObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// DecodeJSON decodes a JSON document and infers its schema. Fields and object fields
+// keep the key order of the source document, so the same input always produces the
+// same schema. The types of all array elements are merged, and conflicting types are
+// reported as an error. The returned data uses map[string]interface{} for objects.
+func DecodeJSON(data []byte) (interface{}, Schema, error) {
+	ordered, err := decodeOrderedJSON(data)
+	if err != nil {
+		return nil, Schema{}, fmt.Errorf("invalid JSON: %v", err)
+	}
+	schema, err := InferSchemaFromSamples(ordered)
+	if err != nil {
+		return nil, Schema{}, err
+	}
+	return plainJSON(ordered), schema, nil
+}
+
+// decodeOrderedJSON decodes a single JSON value token by token, keeping object key order
+func decodeOrderedJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	value, err := readJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+	return value, nil
+}
+
+// readJSONValue reads the next complete value from dec
+func readJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		obj := &jsonObject{values: make(map[string]interface{})}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := keyTok.(string)
+			value, err := readJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := obj.values[key]; !exists {
+				obj.keys = append(obj.keys, key)
+			}
+			obj.values[key] = value
+		}
+		// Consume the closing brace
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return obj, nil
+
+	case json.Delim('['):
+		arr := make([]interface{}, 0)
+		for dec.More() {
+			value, err := readJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		// Consume the closing bracket
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return arr, nil
+
+	default:
+		return tok, nil
+	}
+}
+
+// plainJSON converts decoded values back to the generic form produced by json.Unmarshal
+func plainJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *jsonObject:
+		result := make(map[string]interface{}, len(v.values))
+		for key, val := range v.values {
+			result[key] = plainJSON(val)
+		}
+		return result
+
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, val := range v {
+			result[i] = plainJSON(val)
+		}
+		return result
+
+	default:
+		return value
+	}
+}
+
+// JSONValue returns a parsed document with every value in a form that encoding/json writes
+// as the matching JSON value. Timestamps, dates and durations become their canonical text.
+func (s Schema) JSONValue(document interface{}) interface{} {
+	if s.IsArray() {
+		return jsonValue(document, s.Fields[arrayDocumentField])
+	}
+	return jsonValue(document, s.objectType())
+}
+
+// jsonValue converts a parsed value of the given type for JSON encoding
+func jsonValue(value interface{}, fieldType FieldType) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	switch fieldType.Type {
+	case "timestamp", "date", "duration":
+		if text, err := formatTemporalValue(value, fieldType); err == nil {
+			return text
+		}
+
+	case "bytes":
+		if data, err := toBytes(value, fieldType); err == nil {
+			return encodeBytes(data, fieldType)
+		}
+
+	case "enum":
+		if text, err := toEnumValue(value, fieldType); err == nil {
+			return text
+		}
+
+	case "decimal":
+		// A json.Number keeps every digit, where a float64 would round
+		if d, err := toDecimal(value, fieldType); err == nil {
+			return json.Number(d.String())
+		}
+
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok || fieldType.ElementType == nil {
+			return value
+		}
+		result := make([]interface{}, len(arr))
+		for i, elem := range arr {
+			result[i] = jsonValue(elem, *fieldType.ElementType)
+		}
+		return result
+
+	case "union":
+		if _, variantType, err := unionVariant(value, fieldType); err == nil {
+			return jsonValue(value, variantType)
+		}
+
+	case "map":
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		result := make(map[string]interface{}, len(m))
+		for key, val := range m {
+			result[key] = jsonValue(val, *fieldType.ElementType)
+		}
+		return result
+
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		result := make(map[string]interface{}, len(obj))
+		for key, val := range obj {
+			if fieldDef, exists := fieldType.ObjectFields[key]; exists {
+				val = jsonValue(val, fieldDef)
+			}
+			result[key] = val
+		}
+		return result
+	}
+
+	return value
+}
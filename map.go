@@ -0,0 +1,214 @@
+package metadat
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// parseMapType parses the key and value types of a map<string,T> type. Keys are always
+// strings; the value type is kept in ElementType.
+func parseMapType(params string, scope typeScope) (FieldType, error) {
+	keyTypeStr, valueTypeStr, ok := strings.Cut(params, ",")
+	if !ok {
+		return FieldType{}, fmt.Errorf("invalid map type: map<%s>", params)
+	}
+	if keyType := strings.TrimSpace(keyTypeStr); keyType != "string" {
+		return FieldType{}, fmt.Errorf("unsupported map key type: %s", keyType)
+	}
+	valueType, err := parseTypeIn(valueTypeStr, scope)
+	if err != nil {
+		return FieldType{}, err
+	}
+	return FieldType{Type: "map", ElementType: &valueType}, nil
+}
+
+// mapKeySegment returns the path segment of the map entry with the given key
+func mapKeySegment(key string) string {
+	return fmt.Sprintf("[%q]", key)
+}
+
+// parseMapBlock parses a map written one "key: value" entry per line
+func parseMapBlock(fieldType FieldType, body []line) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+
+	for _, block := range splitBlocks(body) {
+		key, size, valueStr, err := parseMapEntryHeader(block.header)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := result[key]; exists {
+			return nil, duplicateKey(block.header.num, block.header.indent()+1, key)
+		}
+
+		value, err := parseEntryValue(*fieldType.ElementType, size, block.header, valueStr, block.body)
+		if err != nil {
+			return nil, annotate(err, mapKeySegment(key), block.header.num, 0)
+		}
+		result[key] = value
+	}
+
+	return result, nil
+}
+
+// parseMapEntryHeader splits a "key:", "key: value" or "key[3]: value" line of a map.
+// Keys that are not plain names are written as quoted strings.
+func parseMapEntryHeader(l line) (key string, size int, value string, err error) {
+	text := strings.TrimSpace(l.text)
+	column := l.indent() + 1
+
+	key, rest, err := cutMapKey(text)
+	if err != nil {
+		return "", -1, "", &SyntaxError{Position: Position{Line: l.num, Column: column}, Text: text, Msg: err.Error()}
+	}
+
+	size = -1
+	if strings.HasPrefix(rest, "[") {
+		sizeColumn := column + len(text) - len(rest) + 1
+		sizeStr, after, ok := strings.Cut(rest[1:], "]")
+		if ok {
+			size, err = strconv.Atoi(sizeStr)
+		}
+		if !ok || err != nil || size < 0 {
+			return "", -1, "", &SyntaxError{Position: Position{Line: l.num, Column: sizeColumn}, Text: sizeStr, Msg: "invalid array size: " + sizeStr}
+		}
+		rest = after
+	}
+
+	rest = strings.TrimLeft(rest, " \t")
+	if !strings.HasPrefix(rest, ":") {
+		return "", -1, "", &SyntaxError{Position: Position{Line: l.num, Column: column}, Text: text, Msg: "invalid data format: " + text}
+	}
+	return key, size, strings.TrimSpace(rest[1:]), nil
+}
+
+// cutMapKey splits the key, bare or quoted, from the start of a map entry and returns the
+// text that follows it
+func cutMapKey(s string) (key string, rest string, err error) {
+	if !strings.HasPrefix(s, `"`) {
+		end := strings.IndexAny(s, ":[")
+		if end == -1 {
+			return "", "", fmt.Errorf("invalid map entry: %s", s)
+		}
+		return strings.TrimSpace(s[:end]), s[end:], nil
+	}
+
+	end := quotedLength(s)
+	if end == -1 {
+		return "", "", fmt.Errorf("invalid quoted string: %s", s)
+	}
+	key, err = strconv.Unquote(s[:end])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid quoted string: %s", s[:end])
+	}
+	return key, s[end:], nil
+}
+
+// quotedLength returns the length of the quoted string at the start of s, or -1 when it
+// is not terminated
+func quotedLength(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// parseInlineMap parses the key:value entries of a map written as {k1:v1|k2:v2} inside a
+// pipe-separated line, starting at column
+func parseInlineMap(fieldType FieldType, inner string, column int) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	if strings.TrimSpace(inner) == "" {
+		return result, nil
+	}
+
+	entries, offsets := splitPipeOffsets(inner)
+	for i, entry := range entries {
+		entry, entryColumn := trimValue(entry, column+offsets[i])
+		key, rest, err := cutMapKey(entry)
+		if err == nil && !strings.HasPrefix(strings.TrimLeft(rest, " \t"), ":") {
+			err = fmt.Errorf("invalid map entry: %s", entry)
+		}
+		if err != nil {
+			return nil, &SyntaxError{Position: Position{Column: entryColumn}, Text: entry, Msg: err.Error()}
+		}
+		if _, exists := result[key]; exists {
+			return nil, duplicateKey(0, entryColumn, key)
+		}
+
+		rest = strings.TrimLeft(rest, " \t")
+		valueStr, valueColumn := trimValue(rest[1:], entryColumn+len(entry)-len(rest)+1)
+		value, err := parseInlineValue(*fieldType.ElementType, valueStr, valueColumn)
+		if err != nil {
+			return nil, annotate(err, mapKeySegment(key), 0, valueColumn)
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+// duplicateKey reports a map key that appears more than once
+func duplicateKey(lineNum, column int, key string) error {
+	return &SchemaError{Position: Position{Line: lineNum, Column: column, Path: mapKeySegment(key)}, Text: key, Msg: "duplicate map key"}
+}
+
+// formatMapKey writes a map key, quoting keys that would not parse back as a bare name
+func formatMapKey(key string) string {
+	if needsQuoting(key) || strings.Contains(key, ":") {
+		return strconv.Quote(key)
+	}
+	return key
+}
+
+// formatInlineMap writes a map as {k1:v1|k2:v2} with its keys in alphabetical order
+func formatInlineMap(value interface{}, fieldType FieldType) (string, error) {
+	m, err := toMap(value)
+	if err != nil {
+		return "", err
+	}
+	entries := make([]string, 0, len(m))
+	for _, key := range sortedKeys(m) {
+		valueStr, err := formatInlineValue(m[key], fieldType.ElementType)
+		if err != nil {
+			return "", fmt.Errorf("key %q: %v", key, err)
+		}
+		entries = append(entries, formatMapKey(key)+":"+valueStr)
+	}
+	return "{" + strings.Join(entries, "|") + "}", nil
+}
+
+// toMap returns the entries of a parsed map value
+func toMap(value interface{}) (map[string]interface{}, error) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected map, got %T", value)
+	}
+	return m, nil
+}
+
+// assignMap stores a parsed map into a Go map with string keys
+func assignMap(dst reflect.Value, src interface{}, fieldType FieldType, path string) error {
+	m, err := toMap(src)
+	if err != nil {
+		return fmt.Errorf("%s: %v", describePath(path), err)
+	}
+	if dst.Kind() != reflect.Map || dst.Type().Key().Kind() != reflect.String {
+		return assignError(fieldType, dst.Type(), path)
+	}
+
+	result := reflect.MakeMapWithSize(dst.Type(), len(m))
+	for _, key := range sortedKeys(m) {
+		elem := reflect.New(dst.Type().Elem()).Elem()
+		if err := assignValue(elem, m[key], *fieldType.ElementType, path+mapKeySegment(key)); err != nil {
+			return err
+		}
+		result.SetMapIndex(reflect.ValueOf(key).Convert(dst.Type().Key()), elem)
+	}
+	dst.Set(result)
+	return nil
+}
@@ -7,15 +7,20 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Parser handles parsing of MetaDat format files
 type Parser struct {
-	schema Schema
+	schema  Schema
+	collect bool   // continue after errors, see SetCollectErrors
+	loader  Loader // loads the files named by import directives, see SetLoader
 }
 
 // Writer handles writing data to MetaDat format
@@ -37,29 +42,61 @@ func NewWriter() *Writer {
 	}
 }
 
+// SetCollectErrors makes the parser continue after errors instead of stopping at the first
+// one. Fields and array elements with errors are left out, and the partially parsed document
+// is returned together with an ErrorList of every error found. When the meta section has
+// errors, they are all returned and the data section is not parsed.
+func (p *Parser) SetCollectErrors(collect bool) {
+	p.collect = collect
+}
+
+// SetLoader sets the Loader that reads the schema files named by import directives in the
+// meta section. By default, only the schema files read by ParseFromFiles and
+// ParseDocumentFromFiles may import, from the file system relative to that file; imports
+// in documents parsed from strings are rejected.
+func (p *Parser) SetLoader(loader Loader) {
+	p.loader = loader
+}
+
 // ParseMetaDat parses a complete MetaDat format string with both meta and data sections
 func (p *Parser) ParseMetaDat(content string) (map[string]interface{}, error) {
-	sections := strings.Split(content, "\ndata\n")
-	if len(sections) != 2 {
-		return nil, fmt.Errorf("invalid MetaDat format: must have 'meta' and 'data' sections")
-	}
+	return objectDocument(p.ParseDocument(content))
+}
+
+// ParseArray parses a complete MetaDat document whose root is an array of records
+func (p *Parser) ParseArray(content string) ([]interface{}, error) {
+	return arrayDocument(p.ParseDocument(content))
+}
 
-	metaSection := strings.TrimPrefix(sections[0], "meta\n")
-	dataSection := sections[1]
+// ParseDocument parses a complete MetaDat document whose root is either an object or an
+// array, returning a map[string]interface{} or a []interface{} respectively
+func (p *Parser) ParseDocument(content string) (interface{}, error) {
+	decoder := NewDecoder(strings.NewReader(content))
+	decoder.SetCollectErrors(p.collect)
+	decoder.SetLoader(p.loader)
 
 	// Parse schema
-	schema, err := parseSchema(metaSection)
+	schema, err := decoder.Schema()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse schema: %v", err)
+		return nil, err
 	}
 	p.schema = schema
+	if len(p.schema.Fields) == 0 {
+		return nil, fmt.Errorf("no schema loaded")
+	}
 
 	// Parse data
-	return p.ParseData(dataSection)
+	return decodeDocument(decoder)
 }
 
 // ParseFromFiles parses MetaDat from separate schema and data files
 func (p *Parser) ParseFromFiles(schemaFile, dataFile string) (map[string]interface{}, error) {
+	return objectDocument(p.ParseDocumentFromFiles(schemaFile, dataFile))
+}
+
+// ParseDocumentFromFiles parses a MetaDat document from separate schema and data files,
+// returning a map[string]interface{} or a []interface{} depending on the document root
+func (p *Parser) ParseDocumentFromFiles(schemaFile, dataFile string) (interface{}, error) {
 	// Read schema file
 	schemaContent, err := os.ReadFile(schemaFile)
 	if err != nil {
@@ -67,162 +104,97 @@ func (p *Parser) ParseFromFiles(schemaFile, dataFile string) (map[string]interfa
 	}
 
 	// Parse schema
-	schema, err := parseSchema(string(schemaContent))
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse schema: %v", err)
+	if err := p.parseSchemaFile(string(schemaContent), schemaFile); err != nil {
+		return nil, err
+	}
+	if len(p.schema.Fields) == 0 {
+		return nil, fmt.Errorf("no schema loaded")
 	}
-	p.schema = schema
 
-	// Read data file
-	dataContent, err := os.ReadFile(dataFile)
+	// Stream the data file rather than reading it into memory
+	file, err := os.Open(dataFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read data file: %v", err)
 	}
+	defer file.Close()
 
 	// Parse data
-	return p.ParseData(string(dataContent))
+	return decodeDocument(p.newDataDecoder(file))
 }
 
 // ParseSchema parses only the schema definition
 func (p *Parser) ParseSchema(schemaContent string) error {
-	schema, err := parseSchema(schemaContent)
-	if err != nil {
-		return err
+	return p.parseSchemaFile(schemaContent, "")
+}
+
+// parseSchemaFile parses the schema definition read from file, which imports are relative
+// to; file is empty when the schema was not read from a file
+func (p *Parser) parseSchemaFile(schemaContent, file string) error {
+	schema, errs := parseSchemaAll(schemaContent, newImporter(p.loader, file))
+	if len(errs) > 0 {
+		if p.collect {
+			return errs
+		}
+		return errs[0]
 	}
 	p.schema = schema
 	return nil
 }
 
+// Schema returns the schema loaded by the last call to ParseSchema or to a Parse method
+func (p *Parser) Schema() Schema {
+	return p.schema
+}
+
 // ParseData parses the data section using the current schema
 func (p *Parser) ParseData(dataContent string) (map[string]interface{}, error) {
 	if len(p.schema.Fields) == 0 {
 		return nil, fmt.Errorf("no schema loaded")
 	}
 
-	result := make(map[string]interface{})
-	lines := strings.Split(strings.TrimSpace(dataContent), "\n")
-	i := 0
-
-	for i < len(lines) {
-		line := strings.TrimSpace(lines[i])
-		if line == "" {
-			i++
-			continue
-		}
-
-		colonIndex := strings.Index(line, ":")
-		if colonIndex == -1 {
-			return nil, fmt.Errorf("invalid data format at line %d: %s", i+1, line)
-		}
-
-		fieldNameWithSize := strings.TrimSpace(line[:colonIndex])
-		fieldValue := strings.TrimSpace(line[colonIndex+1:])
-
-		// Handle array notation like "arrayName[3]:"
-		fieldName := fieldNameWithSize
-		arraySize := 0
-		if strings.Contains(fieldNameWithSize, "[") {
-			bracketIndex := strings.Index(fieldNameWithSize, "[")
-			closeBracketIndex := strings.Index(fieldNameWithSize, "]")
-			if closeBracketIndex > bracketIndex {
-				fieldName = fieldNameWithSize[:bracketIndex]
-				sizeStr := fieldNameWithSize[bracketIndex+1 : closeBracketIndex]
-				if size, err := strconv.Atoi(sizeStr); err == nil {
-					arraySize = size
-				}
-			}
-		}
-
-		fieldType, exists := p.schema.Fields[fieldName]
-		if !exists {
-			return nil, fmt.Errorf("unknown field: %s", fieldName)
-		}
-
-		value, newIndex, err := p.parseValueWithArraySize(fieldType, fieldValue, lines, i, arraySize)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing field %s: %v", fieldName, err)
-		}
+	return objectDocument(decodeDocument(p.newDataDecoder(strings.NewReader(dataContent))))
+}
 
-		result[fieldName] = value
-		i = newIndex
+// ParseArrayData parses the data section of an array document using the current schema
+func (p *Parser) ParseArrayData(dataContent string) ([]interface{}, error) {
+	if len(p.schema.Fields) == 0 {
+		return nil, fmt.Errorf("no schema loaded")
 	}
 
-	return result, nil
+	return arrayDocument(decodeDocument(p.newDataDecoder(strings.NewReader(dataContent))))
 }
 
-// parseValueWithArraySize parses a value with the array size specified in the format
-func (p *Parser) parseValueWithArraySize(fieldType FieldType, valueStr string, lines []string, currentIndex int, arraySize int) (interface{}, int, error) {
-	switch fieldType.Type {
-	case "array":
-		return p.parseArrayWithDeclaredSize(fieldType, valueStr, lines, currentIndex, arraySize)
-	default:
-		return parseValue(fieldType, valueStr, lines, currentIndex)
-	}
+// newDataDecoder creates a Decoder for a data section using the current schema and error mode
+func (p *Parser) newDataDecoder(r io.Reader) *Decoder {
+	decoder := NewDataDecoder(r, p.schema)
+	decoder.SetCollectErrors(p.collect)
+	return decoder
 }
 
-// parseArrayWithDeclaredSize parses an array value using the size declared in the format
-func (p *Parser) parseArrayWithDeclaredSize(fieldType FieldType, valueStr string, lines []string, currentIndex int, declaredSize int) ([]interface{}, int, error) {
-	// Check if values are on the same line (pipe-separated)
-	if valueStr != "" && strings.Contains(valueStr, "|") {
-		values := strings.Split(valueStr, "|")
-		// Validate that the number of values matches the declared size
-		if declaredSize > 0 && len(values) != declaredSize {
-			return nil, currentIndex, fmt.Errorf("array size mismatch: declared %d, found %d elements", declaredSize, len(values))
-		}
-		result := make([]interface{}, len(values))
-		for i, v := range values {
-			result[i] = strings.TrimSpace(v)
-		}
-		return result, currentIndex + 1, nil
+// objectDocument returns the fields of a parsed document whose root is an object, passing
+// on err from parsing it
+func objectDocument(document interface{}, err error) (map[string]interface{}, error) {
+	if document == nil {
+		return nil, err
 	}
-
-	// For multi-line arrays, parse exactly the declared number of elements
-	expectedSize := declaredSize
-	if expectedSize <= 0 {
-		// If no size declared, parse until end of indented block
-		expectedSize = 1000000 // Large fallback for undeclared arrays
+	data, ok := document.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("document root is an array, use ParseArray")
 	}
+	return data, err
+}
 
-	// Parse multi-line array elements
-	result := make([]interface{}, 0, expectedSize)
-	i := currentIndex + 1
-
-	for i < len(lines) && (declaredSize <= 0 || len(result) < declaredSize) {
-		line := lines[i]
-		
-		// Check if line is indented (part of array)
-		if !strings.HasPrefix(line, "    ") && !strings.HasPrefix(line, "\t") {
-			break
-		}
-
-		trimmedLine := strings.TrimSpace(line)
-		if trimmedLine == "" {
-			i++
-			continue
-		}
-
-		// Parse array element based on element type
-		if fieldType.ElementType != nil && fieldType.ElementType.Type == "object" {
-			// Parse object from pipe-separated values
-			obj, _, err := parseObjectFromLine(trimmedLine, fieldType.ElementType)
-			if err != nil {
-				return nil, i, err
-			}
-			result = append(result, obj)
-		} else {
-			// Simple value
-			result = append(result, trimmedLine)
-		}
-		
-		i++
+// arrayDocument returns the records of a parsed document whose root is an array, passing
+// on err from parsing it
+func arrayDocument(document interface{}, err error) ([]interface{}, error) {
+	if document == nil {
+		return nil, err
 	}
-
-	// Validate that we got the expected number of elements
-	if declaredSize > 0 && len(result) != declaredSize {
-		return nil, i, fmt.Errorf("array size mismatch: declared %d, found %d elements", declaredSize, len(result))
+	records, ok := document.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("document root is not an array")
 	}
-
-	return result, i, nil
+	return records, err
 }
 
 // WriteStruct writes a Go struct to MetaDat format
@@ -251,23 +223,47 @@ func (w *Writer) WriteMetaDat(data map[string]interface{}) (string, error) {
 	}
 
 	var buffer bytes.Buffer
-	
-	// Write meta section
-	buffer.WriteString("meta\n")
-	schemaStr := w.schema.ToString()
-	buffer.WriteString(schemaStr)
-	
-	// Write data section
-	buffer.WriteString("\ndata\n")
-	dataStr, err := w.writeData(data)
-	if err != nil {
+	encoder := NewEncoder(&buffer, w.schema)
+
+	if err := w.encodeFields(encoder, data); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
 		return "", err
 	}
-	buffer.WriteString(dataStr)
 
 	return buffer.String(), nil
 }
 
+// WriteArray writes an array of records as a MetaDat array document. The schema is
+// inferred from the records when none has been set.
+func (w *Writer) WriteArray(data []interface{}) (string, error) {
+	if err := w.prepareArraySchema(data); err != nil {
+		return "", err
+	}
+	return w.WriteMetaDat(map[string]interface{}{arrayDocumentField: data})
+}
+
+// WriteArrayToFiles writes an array of records to separate schema and data files
+func (w *Writer) WriteArrayToFiles(data []interface{}, schemaFile, dataFile string) error {
+	if err := w.prepareArraySchema(data); err != nil {
+		return err
+	}
+	return w.WriteToFiles(map[string]interface{}{arrayDocumentField: data}, schemaFile, dataFile)
+}
+
+// prepareArraySchema infers an array document schema when none is set and checks that
+// the schema describes an array document
+func (w *Writer) prepareArraySchema(data []interface{}) error {
+	if len(w.schema.Fields) == 0 {
+		w.schema = InferSchemaFromJSON(data)
+	}
+	if !w.schema.IsArray() {
+		return fmt.Errorf("schema does not describe an array document")
+	}
+	return nil
+}
+
 // WriteSeparated writes schema and data to separate strings
 func (w *Writer) WriteSeparated(v interface{}) (schema string, dataContent string, err error) {
 	// Handle both struct and map inputs
@@ -364,13 +360,25 @@ func (w *Writer) SetSchema(schema Schema) {
 // writeData writes the data portion of MetaDat format
 func (w *Writer) writeData(data map[string]interface{}) (string, error) {
 	var buffer bytes.Buffer
+	encoder := NewDataEncoder(&buffer, w.schema)
 
+	if err := w.encodeFields(encoder, data); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+// encodeFields writes the fields of data in schema order
+func (w *Writer) encodeFields(encoder *Encoder, data map[string]interface{}) error {
 	// Get ordered field names from schema
 	fieldOrder := w.schema.GetFieldOrder()
 
 	for _, fieldName := range fieldOrder {
-		fieldType, exists := w.schema.Fields[fieldName]
-		if !exists {
+		if _, exists := w.schema.Fields[fieldName]; !exists {
 			continue
 		}
 
@@ -380,36 +388,82 @@ func (w *Writer) writeData(data map[string]interface{}) (string, error) {
 			continue
 		}
 
-		fieldStr, err := w.writeField(fieldName, value, fieldType, 0)
-		if err != nil {
-			return "", fmt.Errorf("error writing field %s: %v", fieldName, err)
-		}
-
-		buffer.WriteString(fieldStr)
-		if !strings.HasSuffix(fieldStr, "\n") {
-			buffer.WriteString("\n")
+		if err := encoder.WriteField(fieldName, value); err != nil {
+			return err
 		}
 	}
 
-	return buffer.String(), nil
+	return nil
 }
 
 // writeField writes a single field in MetaDat format
 func (w *Writer) writeField(name string, value interface{}, fieldType FieldType, indent int) (string, error) {
 	indentStr := strings.Repeat("    ", indent)
 
+	if value == nil {
+		if !fieldType.Nullable {
+			return "", fmt.Errorf("null value for non-nullable field %s", name)
+		}
+		return fmt.Sprintf("%s%s: null", indentStr, name), nil
+	}
+
 	switch fieldType.Type {
 	case "string":
-		return fmt.Sprintf("%s%s:\n%s    %v", indentStr, name, indentStr, value), nil
+		if s, ok := value.(string); ok {
+			if indicator, lines, ok := formatBlockString(s); ok {
+				var buffer bytes.Buffer
+				buffer.WriteString(fmt.Sprintf("%s%s: %s", indentStr, name, indicator))
+				for _, l := range lines {
+					buffer.WriteString("\n")
+					if l != "" {
+						buffer.WriteString(indentStr + "    " + l)
+					}
+				}
+				return buffer.String() + "\n", nil
+			}
+		}
+		return fmt.Sprintf("%s%s:\n%s    %s", indentStr, name, indentStr, formatSimpleValue(value)), nil
 
-	case "int", "int32", "int64":
-		return fmt.Sprintf("%s%s:\n%s    %v", indentStr, name, indentStr, value), nil
+	case "int", "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64":
+		text, err := formatIntegerValue(value, fieldType)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s%s:\n%s    %s", indentStr, name, indentStr, text), nil
 
 	case "float32", "float64":
-		return fmt.Sprintf("%s%s:\n%s    %v", indentStr, name, indentStr, value), nil
+		return fmt.Sprintf("%s%s:\n%s    %s", indentStr, name, indentStr, formatSimpleValue(value)), nil
 
 	case "bool":
-		return fmt.Sprintf("%s%s:\n%s    %v", indentStr, name, indentStr, value), nil
+		return fmt.Sprintf("%s%s:\n%s    %s", indentStr, name, indentStr, formatSimpleValue(value)), nil
+
+	case "timestamp", "date", "duration":
+		text, err := formatTemporalValue(value, fieldType)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s%s:\n%s    %s", indentStr, name, indentStr, text), nil
+
+	case "bytes":
+		text, err := formatBytesValue(value, fieldType)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s%s:\n%s    %s", indentStr, name, indentStr, text), nil
+
+	case "enum":
+		text, err := toEnumValue(value, fieldType)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s%s:\n%s    %s", indentStr, name, indentStr, text), nil
+
+	case "decimal":
+		d, err := toDecimal(value, fieldType)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s%s:\n%s    %s", indentStr, name, indentStr, d), nil
 
 	case "array":
 		arr, ok := value.([]interface{})
@@ -420,37 +474,21 @@ func (w *Writer) writeField(name string, value interface{}, fieldType FieldType,
 				return "", fmt.Errorf("expected array for field %s", name)
 			}
 		}
+		return w.writeArray(indentStr+name, arr, fieldType, indent)
 
-		var buffer bytes.Buffer
-		buffer.WriteString(fmt.Sprintf("%s%s[%d]:", indentStr, name, len(arr)))
+	case "map":
+		return w.writeMap(indentStr+name, value, fieldType, indent)
 
-		if len(arr) == 0 {
-			return buffer.String(), nil
+	case "union":
+		obj, variantType, err := unionVariant(value, fieldType)
+		if err != nil {
+			return "", err
 		}
-
-		// Check if it's a simple type array
-		if fieldType.ElementType != nil && isSimpleType(fieldType.ElementType.Type) {
-			// Write as pipe-separated values on same line
-			buffer.WriteString(" ")
-			values := make([]string, len(arr))
-			for i, item := range arr {
-				values[i] = fmt.Sprintf("%v", item)
-			}
-			buffer.WriteString(strings.Join(values, "|"))
-		} else {
-			// Write as multi-line for complex types
-			buffer.WriteString("\n")
-			for _, item := range arr {
-				itemStr, err := w.writeArrayItem(item, fieldType.ElementType, indent+1)
-				if err != nil {
-					return "", err
-				}
-				buffer.WriteString(itemStr)
-				buffer.WriteString("\n")
-			}
+		line, err := formatObjectLine(obj, &variantType)
+		if err != nil {
+			return "", err
 		}
-
-		return strings.TrimRight(buffer.String(), "\n"), nil
+		return fmt.Sprintf("%s%s:\n%s    %s", indentStr, name, indentStr, line), nil
 
 	case "object":
 		obj, ok := value.(map[string]interface{})
@@ -462,14 +500,11 @@ func (w *Writer) writeField(name string, value interface{}, fieldType FieldType,
 		buffer.WriteString(fmt.Sprintf("%s%s:\n", indentStr, name))
 
 		// Write object fields in pipe-separated format
-		values := make([]string, 0)
-		fieldOrder := getObjectFieldOrder(&fieldType)
-		for _, fieldName := range fieldOrder {
-			if val, exists := obj[fieldName]; exists {
-				values = append(values, fmt.Sprintf("%v", val))
-			}
+		line, err := formatObjectLine(obj, &fieldType)
+		if err != nil {
+			return "", err
 		}
-		buffer.WriteString(fmt.Sprintf("%s    %s", indentStr, strings.Join(values, "|")))
+		buffer.WriteString(fmt.Sprintf("%s    %s", indentStr, wrapObjectLine(line, fieldType)))
 
 		return buffer.String(), nil
 
@@ -478,12 +513,99 @@ func (w *Writer) writeField(name string, value interface{}, fieldType FieldType,
 	}
 }
 
+// maxInlineElements is the largest number of simple-type elements written inline on the
+// header line of an array. Longer arrays are written one element per line, so that a
+// Decoder can stream them instead of holding the whole line in memory.
+const maxInlineElements = 1000
+
+// inlineArray reports whether an array of n elements of fieldType is written inline
+func inlineArray(fieldType FieldType, n int) bool {
+	return fieldType.ElementType != nil && isSimpleType(fieldType.ElementType.Type) && n <= maxInlineElements
+}
+
+// writeArray writes a "prefix[N]:" header followed by the array elements, inline for
+// short arrays of simple element types and one per line, indented below the header, otherwise
+func (w *Writer) writeArray(prefix string, arr []interface{}, fieldType FieldType, indent int) (string, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("%s[%d]:", prefix, len(arr)))
+
+	if len(arr) == 0 {
+		return buffer.String(), nil
+	}
+
+	// Check if it's a short simple type array
+	if inlineArray(fieldType, len(arr)) {
+		// Write as pipe-separated values on same line
+		buffer.WriteString(" ")
+		values := make([]string, len(arr))
+		for i, item := range arr {
+			value, err := formatInlineValue(item, fieldType.ElementType)
+			if err != nil {
+				return "", fmt.Errorf("element %d: %v", i, err)
+			}
+			values[i] = value
+		}
+		buffer.WriteString(strings.Join(values, "|"))
+	} else {
+		// Write as multi-line for complex types
+		buffer.WriteString("\n")
+		for _, item := range arr {
+			itemStr, err := w.writeArrayItem(item, fieldType.ElementType, indent+1)
+			if err != nil {
+				return "", err
+			}
+			buffer.WriteString(itemStr)
+			buffer.WriteString("\n")
+		}
+	}
+
+	return strings.TrimRight(buffer.String(), "\n"), nil
+}
+
+// writeMap writes a "prefix:" header followed by the map entries in alphabetical key order,
+// one per line. Entries with simple values are written as "key: value".
+func (w *Writer) writeMap(prefix string, value interface{}, fieldType FieldType, indent int) (string, error) {
+	m, err := toMap(value)
+	if err != nil {
+		return "", err
+	}
+	if len(m) == 0 {
+		return prefix + ": {}", nil
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(prefix + ":")
+	entryIndent := strings.Repeat("    ", indent+1)
+	for _, key := range sortedKeys(m) {
+		var entry string
+		if m[key] == nil || isSimpleType(fieldType.ElementType.Type) {
+			valueStr, err := formatInlineValue(m[key], fieldType.ElementType)
+			if err != nil {
+				return "", fmt.Errorf("key %q: %v", key, err)
+			}
+			entry = entryIndent + formatMapKey(key) + ": " + valueStr
+		} else {
+			entry, err = w.writeField(formatMapKey(key), m[key], *fieldType.ElementType, indent+1)
+			if err != nil {
+				return "", fmt.Errorf("key %q: %v", key, err)
+			}
+		}
+		buffer.WriteString("\n")
+		buffer.WriteString(strings.TrimRight(entry, "\n"))
+	}
+	return buffer.String(), nil
+}
+
 // writeArrayItem writes a single array item
 func (w *Writer) writeArrayItem(item interface{}, itemType *FieldType, indent int) (string, error) {
 	indentStr := strings.Repeat("    ", indent)
 
-	if itemType == nil {
-		return fmt.Sprintf("%s%v", indentStr, item), nil
+	if itemType == nil || item == nil {
+		value, err := formatInlineValue(item, itemType)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s%s", indentStr, value), nil
 	}
 
 	switch itemType.Type {
@@ -494,25 +616,239 @@ func (w *Writer) writeArrayItem(item interface{}, itemType *FieldType, indent in
 			return "", fmt.Errorf("expected object in array")
 		}
 
-		values := make([]string, 0)
-		fieldOrder := getObjectFieldOrder(itemType)
-		for _, fieldName := range fieldOrder {
-			if val, exists := obj[fieldName]; exists {
-				values = append(values, fmt.Sprintf("%v", val))
+		line, err := formatObjectLine(obj, itemType)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s%s", indentStr, wrapObjectLine(line, *itemType)), nil
+
+	case "union":
+		obj, variantType, err := unionVariant(item, *itemType)
+		if err != nil {
+			return "", err
+		}
+		line, err := formatObjectLine(obj, &variantType)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s%s", indentStr, line), nil
+
+	case "array":
+		// Nested arrays are written as "[N]:" headers with their own elements below
+		arr, ok := item.([]interface{})
+		if !ok {
+			arr = convertToInterfaceSlice(item)
+			if arr == nil {
+				return "", fmt.Errorf("expected array in array")
 			}
 		}
-		return fmt.Sprintf("%s%s", indentStr, strings.Join(values, "|")), nil
+		return w.writeArray(indentStr, arr, *itemType, indent)
 
 	default:
-		return fmt.Sprintf("%s%v", indentStr, item), nil
+		value, err := formatInlineValue(item, itemType)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s%s", indentStr, value), nil
 	}
 }
 
 // Helper functions
 
+// formatSimpleValue formats a simple-type value as it appears in the data section.
+// Strings that would not survive parsing verbatim are written as quoted strings.
+func formatSimpleValue(value interface{}) string {
+	if value == nil {
+		return "null"
+	}
+	if s, ok := value.(string); ok && needsQuoting(s) {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// needsQuoting reports whether a string must be quoted to round-trip: it is empty or null, has
+// leading or trailing whitespace, contains a delimiter, bracket or quote, or holds characters
+// that are not printable on a single line
+func needsQuoting(s string) bool {
+	if s == "" || s == "null" || s != strings.TrimSpace(s) || !utf8.ValidString(s) {
+		return true
+	}
+	for _, r := range s {
+		switch r {
+		case '|', '"', '{', '}', '[', ']':
+			return true
+		}
+		if !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatBlockString splits a multi-line string into the lines of a block string and picks
+// the indicator that reproduces its trailing line breaks. It reports false for strings that
+// are better written quoted: single-line strings, strings with carriage returns or other
+// control characters, whitespace-only lines, or a first line starting with whitespace,
+// which would be mistaken for indentation.
+func formatBlockString(s string) (indicator string, lines []string, ok bool) {
+	if !strings.Contains(s, "\n") || !utf8.ValidString(s) {
+		return "", nil, false
+	}
+	for _, r := range s {
+		if r != '\n' && r != '\t' && !unicode.IsPrint(r) {
+			return "", nil, false
+		}
+	}
+
+	content := strings.TrimRight(s, "\n")
+	switch trailing := len(s) - len(content); {
+	case trailing == 0:
+		indicator = "|-"
+	case trailing == 1:
+		indicator = "|"
+	default:
+		indicator = "|+"
+		content = s[:len(s)-1]
+	}
+
+	lines = strings.Split(content, "\n")
+	firstContent := ""
+	for _, l := range lines {
+		if l != "" && strings.TrimSpace(l) == "" {
+			return "", nil, false
+		}
+		if firstContent == "" {
+			firstContent = l
+		}
+	}
+	if firstContent == "" || firstContent != strings.TrimLeft(firstContent, " \t") {
+		return "", nil, false
+	}
+
+	return indicator, lines, true
+}
+
+// formatObjectLine writes object values pipe-separated in schema order.
+// Fields missing from the object leave their position empty.
+func formatObjectLine(obj map[string]interface{}, fieldType *FieldType) (string, error) {
+	fieldOrder := getObjectFieldOrder(fieldType)
+	values := make([]string, len(fieldOrder))
+	for i, fieldName := range fieldOrder {
+		val, exists := obj[fieldName]
+		if !exists {
+			continue
+		}
+		fieldDef := fieldType.ObjectFields[fieldName]
+		value, err := formatInlineValue(val, &fieldDef)
+		if err != nil {
+			return "", fmt.Errorf("field %s: %v", fieldName, err)
+		}
+		values[i] = value
+	}
+
+	// A line starting like "field: value" would be read back as a block of entries
+	text := strings.Join(values, "|")
+	if len(fieldOrder) > 0 && isObjectFieldHeader(line{text: text}, *fieldType) {
+		if s, ok := obj[fieldOrder[0]].(string); ok {
+			values[0] = strconv.Quote(s)
+			text = strings.Join(values, "|")
+		}
+	}
+	return text, nil
+}
+
+// wrapObjectLine wraps the pipe line of an object standing alone on a line in braces when
+// it would not read back as that object: a blank line, null, or a line holding a single
+// braced value
+func wrapObjectLine(text string, fieldType FieldType) string {
+	if strings.TrimSpace(text) == "" || isNull(fieldType, text) || isBraced(text) {
+		return "{" + text + "}"
+	}
+	return text
+}
+
+// formatInlineValue formats a value nested inside a pipe-separated line. Objects are
+// wrapped in braces and arrays in square brackets so that they can nest to any depth.
+func formatInlineValue(value interface{}, fieldType *FieldType) (string, error) {
+	if fieldType == nil {
+		return formatSimpleValue(value), nil
+	}
+	if value == nil {
+		if !fieldType.Nullable {
+			return "", fmt.Errorf("null value for non-nullable type %s", fieldTypeToString(*fieldType))
+		}
+		return "null", nil
+	}
+
+	switch fieldType.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("expected object, got %T", value)
+		}
+		line, err := formatObjectLine(obj, fieldType)
+		if err != nil {
+			return "", err
+		}
+		return "{" + line + "}", nil
+
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			arr = convertToInterfaceSlice(value)
+			if arr == nil {
+				return "", fmt.Errorf("expected array, got %T", value)
+			}
+		}
+		values := make([]string, len(arr))
+		for i, item := range arr {
+			itemStr, err := formatInlineValue(item, fieldType.ElementType)
+			if err != nil {
+				return "", fmt.Errorf("element %d: %v", i, err)
+			}
+			values[i] = itemStr
+		}
+		return "[" + strings.Join(values, "|") + "]", nil
+
+	case "map":
+		return formatInlineMap(value, *fieldType)
+
+	case "union":
+		obj, variantType, err := unionVariant(value, *fieldType)
+		if err != nil {
+			return "", err
+		}
+		line, err := formatObjectLine(obj, &variantType)
+		if err != nil {
+			return "", err
+		}
+		return "{" + line + "}", nil
+
+	case "int", "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64":
+		return formatIntegerValue(value, *fieldType)
+
+	case "timestamp", "date", "duration":
+		return formatTemporalValue(value, *fieldType)
+
+	case "bytes":
+		return formatBytesValue(value, *fieldType)
+
+	case "enum":
+		return toEnumValue(value, *fieldType)
+
+	case "decimal":
+		d, err := toDecimal(value, *fieldType)
+		return d.String(), err
+
+	default:
+		return formatSimpleValue(value), nil
+	}
+}
+
 func isSimpleType(t string) bool {
-	return t == "string" || t == "int" || t == "int32" || t == "int64" ||
-		t == "float32" || t == "float64" || t == "bool"
+	return t == "string" || isIntegerType(t) ||
+		t == "float32" || t == "float64" || t == "bool" || isTemporalType(t) || t == "bytes" || t == "enum" || t == "decimal"
 }
 
 func convertToInterfaceSlice(v interface{}) []interface{} {
@@ -528,55 +864,56 @@ func convertToInterfaceSlice(v interface{}) []interface{} {
 	return result
 }
 
+// structToMap converts a struct (or pointer to one) into the generic map used by the writer,
+// keeping Go number types intact and honouring `metadat` and `json` tags. A slice becomes
+// the root array of an array document.
 func structToMap(v interface{}) (map[string]interface{}, error) {
 	// Handle both struct and map inputs
 	if m, ok := v.(map[string]interface{}); ok {
 		return m, nil
 	}
 
-	data, err := json.Marshal(v)
-	if err != nil {
-		return nil, err
-	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(data, &result); err != nil {
-		return nil, err
+	switch generic := toGeneric(reflect.ValueOf(v)).(type) {
+	case map[string]interface{}:
+		return generic, nil
+	case []interface{}:
+		return map[string]interface{}{arrayDocumentField: generic}, nil
+	default:
+		return nil, fmt.Errorf("expected struct, map or slice, got %T", v)
 	}
-
-	return result, nil
 }
 
 
-// ConvertJSONToMetaDat converts JSON string to MetaDat format
+// ConvertJSONToMetaDat converts JSON string to MetaDat format.
+// Fields are written in the key order of the JSON document.
 func ConvertJSONToMetaDat(jsonStr string) (string, error) {
-	var data interface{}
-	if err := json.Unmarshal([]byte(jsonStr), &data); err != nil {
-		return "", fmt.Errorf("invalid JSON: %v", err)
-	}
-
-	schema := InferSchemaFromJSON(data)
-	
-	// Convert data to map if it's not already
-	dataMap, ok := data.(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("JSON must be an object at root level")
+	data, schema, err := DecodeJSON([]byte(jsonStr))
+	if err != nil {
+		return "", err
 	}
 
 	writer := NewWriter()
 	writer.SetSchema(schema)
-	return writer.WriteMetaDat(dataMap)
+
+	switch root := data.(type) {
+	case map[string]interface{}:
+		return writer.WriteMetaDat(root)
+	case []interface{}:
+		return writer.WriteArray(root)
+	default:
+		return "", fmt.Errorf("JSON must be an object or an array at root level")
+	}
 }
 
 // ConvertMetaDatToJSON converts MetaDat format to JSON
 func ConvertMetaDatToJSON(metadatContent string) (string, error) {
 	parser := NewParser()
-	data, err := parser.ParseMetaDat(metadatContent)
+	data, err := parser.ParseDocument(metadatContent)
 	if err != nil {
 		return "", err
 	}
 
-	jsonBytes, err := json.MarshalIndent(data, "", "  ")
+	jsonBytes, err := json.MarshalIndent(parser.Schema().JSONValue(data), "", "  ")
 	if err != nil {
 		return "", err
 	}
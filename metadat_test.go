@@ -2,8 +2,19 @@ package metadat
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"testing/quick"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -356,6 +367,2222 @@ func TestSchemaValidation(t *testing.T) {
 	assert.Contains(t, err.Error(), "unknown field")
 }
 
+func TestUnmarshalIntoStruct(t *testing.T) {
+	original := Company{
+		Name:    "StartupInc",
+		Founded: 2020,
+		Employees: []Employee{
+			{ID: 1, Name: "Charlie", Role: "Developer", Salary: 80000.5},
+			{ID: 2, Name: "Dana", Role: "Designer", Salary: 75000},
+		},
+	}
+
+	writer := NewWriter()
+	content, err := writer.WriteStruct(original)
+	require.NoError(t, err)
+
+	var decoded Company
+	err = Unmarshal([]byte(content), &decoded)
+	require.NoError(t, err)
+	assert.Equal(t, original, decoded)
+}
+
+func TestParseIntoNestedAndPointers(t *testing.T) {
+	content := `meta
+    name: string
+    scores: int[]
+    address: {city:string|zip:string}
+data
+    name:
+        Alice
+    scores[3]: 90|85|77
+    address:
+        Boston|02101`
+
+	type Address struct {
+		City string `json:"city"`
+		Zip  string `json:"zip"`
+	}
+	type Person struct {
+		Name    *string  `json:"name"`
+		Scores  []int    `json:"scores"`
+		Address *Address `json:"address"`
+	}
+
+	var person Person
+	parser := NewParser()
+	err := parser.ParseInto(content, &person)
+	require.NoError(t, err)
+
+	require.NotNil(t, person.Name)
+	assert.Equal(t, "Alice", *person.Name)
+	assert.Equal(t, []int{90, 85, 77}, person.Scores)
+	require.NotNil(t, person.Address)
+	assert.Equal(t, "Boston", person.Address.City)
+	assert.Equal(t, "02101", person.Address.Zip)
+}
+
+func TestUnmarshalTypeMismatch(t *testing.T) {
+	content := `meta
+    name: string
+    age: int
+data
+    name:
+        Bob
+    age:
+        42`
+
+	var wrongType struct {
+		Name string `json:"name"`
+		Age  bool   `json:"age"`
+	}
+	err := Unmarshal([]byte(content), &wrongType)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot assign schema type int to Go type bool for field age")
+
+	var overflow struct {
+		Age int8 `json:"age"`
+	}
+	err = Unmarshal([]byte(strings.Replace(content, "42", "300", 1)), &overflow)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "overflows Go type int8 for field age")
+
+	var notPointer struct{}
+	err = Unmarshal([]byte(content), notPointer)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "non-nil pointer")
+}
+
+func TestInferSchemaFromStructUsesDeclaredTypes(t *testing.T) {
+	type Measurement struct {
+		Ratio   float64 `json:"ratio"`
+		Weight  float32 `json:"weight"`
+		Count   int64   `json:"count"`
+		Small   int16   `json:"small"`
+		Label   string  `metadat:"title" json:"label"`
+		Code    int     `metadat:"code,type=int64"`
+		Note    string  `metadat:"note,omitempty"`
+		Skipped string  `metadat:"-" json:"skipped"`
+		Active  bool
+	}
+
+	value := Measurement{Ratio: 2.0, Weight: 1.5, Count: 7, Small: 3, Label: "x", Code: 9}
+	schema, err := InferSchemaFromStruct(&value)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"ratio", "weight", "count", "small", "title", "code", "note", "Active"}, schema.FieldOrder)
+	assert.Equal(t, "float64", schema.Fields["ratio"].Type)
+	assert.Equal(t, "float32", schema.Fields["weight"].Type)
+	assert.Equal(t, "int64", schema.Fields["count"].Type)
+	assert.Equal(t, "int16", schema.Fields["small"].Type)
+	assert.Equal(t, "string", schema.Fields["title"].Type)
+	assert.Equal(t, "int64", schema.Fields["code"].Type)
+	assert.Equal(t, "bool", schema.Fields["Active"].Type)
+	assert.NotContains(t, schema.Fields, "skipped")
+
+	writer := NewWriter()
+	content, err := writer.WriteStruct(value)
+	require.NoError(t, err)
+	assert.Contains(t, content, "ratio: float64")
+	assert.NotContains(t, content, "note:\n")
+
+	var decoded Measurement
+	require.NoError(t, Unmarshal([]byte(content), &decoded))
+	assert.Equal(t, value, decoded)
+}
+
+func TestInferSchemaFromStructIgnoresValues(t *testing.T) {
+	type Wrapper struct {
+		Items []Employee `json:"items"`
+		Ptr   *Employee  `json:"ptr"`
+	}
+
+	// Empty slices and nil pointers still produce the full element schema
+	schema, err := InferSchemaFromStruct(Wrapper{})
+	require.NoError(t, err)
+
+	items := schema.Fields["items"]
+	require.NotNil(t, items.ElementType)
+	assert.Equal(t, "{id:int|name:string|role:string|salary:float64}[]", fieldTypeToString(items))
+	assert.Equal(t, "{id:int|name:string|role:string|salary:float64}?", fieldTypeToString(schema.Fields["ptr"]))
+
+	_, err = InferSchemaFromStruct(struct {
+		Bad string `metadat:"bad,type=nonsense"`
+	}{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid type tag for field bad")
+}
+
+type listNode struct {
+	Name string    `json:"name"`
+	Next *listNode `json:"next"`
+}
+
+type treeNode struct {
+	Value    int        `json:"value"`
+	Children []treeNode `json:"children"`
+}
+
+func TestInferSchemaFromRecursiveStruct(t *testing.T) {
+	// Struct types that contain themselves become named types
+	list := listNode{Name: "a", Next: &listNode{Name: "b"}}
+	schema, err := InferSchemaFromStruct(list)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"listNode"}, schema.TypeOrder)
+	assert.Equal(t, "    type listNode = {name:string|next:listNode?}\n    name: string\n    next: listNode?\n", schema.ToString())
+
+	content, err := NewWriter().WriteStruct(list)
+	require.NoError(t, err)
+	var decoded listNode
+	require.NoError(t, Unmarshal([]byte(content), &decoded))
+	assert.Equal(t, list, decoded)
+
+	trees := []treeNode{{Value: 1, Children: []treeNode{{Value: 2, Children: []treeNode{}}}}}
+	schema, err = InferSchemaFromStruct(trees)
+	require.NoError(t, err)
+	assert.Equal(t, "    type treeNode = {value:int|children:treeNode[]}\n    []: treeNode\n", schema.ToString())
+
+	content, err = NewWriter().WriteStruct(trees)
+	require.NoError(t, err)
+	var decodedTrees []treeNode
+	require.NoError(t, Unmarshal([]byte(content), &decodedTrees))
+	assert.Equal(t, trees, decodedTrees)
+}
+
+func TestDecoderStreamsTokens(t *testing.T) {
+	content := `meta
+    name: string
+    tags: string[]
+    employees: {id:int|name:string}[]
+data
+    name:
+        TechCorp
+    tags[2]: a|b
+    employees[3]:
+        1|Alice
+        2|Bob
+        3|Carol`
+
+	decoder := NewDecoder(strings.NewReader(content))
+	schema, err := decoder.Schema()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"name", "tags", "employees"}, schema.FieldOrder)
+
+	var kinds []TokenKind
+	var employees []interface{}
+	for decoder.Next() {
+		tok := decoder.Token()
+		kinds = append(kinds, tok.Kind)
+		switch {
+		case tok.Kind == FieldToken:
+			assert.Equal(t, "name", tok.Name)
+			assert.Equal(t, "TechCorp", tok.Value)
+		case tok.Kind == ArrayStartToken && tok.Name == "employees":
+			assert.Equal(t, 3, tok.Len)
+		case tok.Kind == ElementToken && tok.Name == "employees":
+			assert.Equal(t, len(employees), tok.Index)
+			employees = append(employees, tok.Value)
+		}
+	}
+	require.NoError(t, decoder.Err())
+
+	assert.Equal(t, []TokenKind{
+		FieldToken,
+		ArrayStartToken, ElementToken, ElementToken, ArrayEndToken,
+		ArrayStartToken, ElementToken, ElementToken, ElementToken, ArrayEndToken,
+	}, kinds)
+	require.Len(t, employees, 3)
+	assert.Equal(t, map[string]interface{}{"id": 3, "name": "Carol"}, employees[2])
+}
+
+// recordSource generates a large MetaDat document on the fly without holding it in memory
+type recordSource struct {
+	header  string
+	count   int
+	emitted int
+	pending []byte
+}
+
+func (r *recordSource) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		switch {
+		case r.header != "":
+			r.pending = []byte(r.header)
+			r.header = ""
+		case r.emitted < r.count:
+			r.pending = []byte(fmt.Sprintf("        %d|record-%d\n", r.emitted, r.emitted))
+			r.emitted++
+		default:
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func TestDecoderLargeArray(t *testing.T) {
+	const count = 200000
+	source := &recordSource{
+		header: fmt.Sprintf("meta\n    rows: {id:int|name:string}[]\ndata\n    rows[%d]:\n", count),
+		count:  count,
+	}
+
+	decoder := NewDecoder(source)
+	elements := 0
+	for decoder.Next() {
+		tok := decoder.Token()
+		if tok.Kind == ElementToken {
+			row := tok.Value.(map[string]interface{})
+			require.Equal(t, elements, row["id"])
+			elements++
+		}
+	}
+	require.NoError(t, decoder.Err())
+	assert.Equal(t, count, elements)
+}
+
+func TestDecoderLargeSimpleArray(t *testing.T) {
+	const count = 50000
+	schema, err := parseSchema("ids: int[]\ntags: string[]")
+	require.NoError(t, err)
+	ids := make([]interface{}, count)
+	for i := range ids {
+		ids[i] = i
+	}
+
+	// Long simple-type arrays are written one element per line so they can be streamed
+	writer := NewWriter()
+	writer.SetSchema(schema)
+	content, err := writer.WriteMetaDat(map[string]interface{}{"ids": ids, "tags": []interface{}{"a", "b c"}})
+	require.NoError(t, err)
+	assert.Contains(t, content, fmt.Sprintf("ids[%d]:\n    0\n    1\n", count))
+	assert.Contains(t, content, "tags[2]: a|b c\n")
+
+	for _, declared := range []bool{true, false} {
+		idsSize, tagsSize := count, 2
+		if !declared {
+			idsSize, tagsSize = -1, -1
+		}
+		var out strings.Builder
+		encoder := NewEncoder(&out, schema)
+		require.NoError(t, encoder.BeginArray("ids", idsSize))
+		for _, id := range ids {
+			require.NoError(t, encoder.WriteElement(id))
+		}
+		require.NoError(t, encoder.EndArray())
+		require.NoError(t, encoder.BeginArray("tags", tagsSize))
+		require.NoError(t, encoder.WriteElement("a"))
+		require.NoError(t, encoder.WriteElement("b c"))
+		require.NoError(t, encoder.EndArray())
+		require.NoError(t, encoder.Close())
+		// Spooled tags are joined inline at EndArray, like the Writer output
+		assert.Equal(t, content, out.String())
+
+		decoder := NewDecoder(strings.NewReader(out.String()))
+		elements := 0
+		for decoder.Next() {
+			tok := decoder.Token()
+			if tok.Kind == ElementToken && tok.Name == "ids" {
+				require.Equal(t, elements, tok.Value)
+				elements++
+			}
+		}
+		require.NoError(t, decoder.Err())
+		assert.Equal(t, count, elements)
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	// Declared size larger than the actual element count
+	decoder := NewDecoder(strings.NewReader("meta\n    ids: {id:int}[]\ndata\n    ids[3]:\n        1\n        2\n"))
+	for decoder.Next() {
+	}
+	require.Error(t, decoder.Err())
+	assert.Contains(t, decoder.Err().Error(), "array size mismatch: declared 3, found 2 elements")
+
+	// Declared size smaller than the actual element count
+	decoder = NewDecoder(strings.NewReader("meta\n    ids: {id:int}[]\ndata\n    ids[1]:\n        1\n        2\n        3\n"))
+	for decoder.Next() {
+	}
+	require.Error(t, decoder.Err())
+	assert.Contains(t, decoder.Err().Error(), "array size mismatch: declared 1, found 3 elements")
+
+	// Missing data section
+	decoder = NewDecoder(strings.NewReader("meta\n    name: string\n"))
+	assert.False(t, decoder.Next())
+	assert.Contains(t, decoder.Err().Error(), "must have 'meta' and 'data' sections")
+
+	// Separated data with a known schema
+	schema := Schema{Fields: map[string]FieldType{"age": {Type: "int"}}, FieldOrder: []string{"age"}}
+	decoder = NewDataDecoder(strings.NewReader("    age:\n        forty\n"), schema)
+	assert.False(t, decoder.Next())
+	assert.Contains(t, decoder.Err().Error(), "line 2, column 9: field age: invalid integer value: forty")
+
+	// Reading stops at the first field that fails to parse and keeps its error
+	content := "meta\n    age: int\n    n: int\n    ok: string\ndata\n    age: forty\n    n: x\n    ok: fine\n"
+	decoder = NewDecoder(strings.NewReader(content))
+	assert.False(t, decoder.Next())
+	assert.False(t, decoder.Next())
+	assert.EqualError(t, decoder.Err(), "line 6, column 10: field age: invalid integer value: forty")
+	_, err := NewParser().ParseMetaDat(content)
+	assert.EqualError(t, err, "line 6, column 10: field age: invalid integer value: forty")
+}
+
+func TestEncoderMatchesWriter(t *testing.T) {
+	company := Company{
+		Name:    "TechCorp",
+		Founded: 2010,
+		Employees: []Employee{
+			{ID: 1, Name: "Alice", Role: "CEO", Salary: 150000.5},
+			{ID: 2, Name: "Bob", Role: "CTO", Salary: 140000.25},
+		},
+	}
+
+	writer := NewWriter()
+	expected, err := writer.WriteStruct(company)
+	require.NoError(t, err)
+
+	schema, err := InferSchemaFromStruct(company)
+	require.NoError(t, err)
+
+	var out strings.Builder
+	encoder := NewEncoder(&out, schema)
+	require.NoError(t, encoder.WriteField("name", company.Name))
+	require.NoError(t, encoder.WriteField("founded", company.Founded))
+	require.NoError(t, encoder.BeginArray("employees", len(company.Employees)))
+	for _, employee := range company.Employees {
+		row, err := structToMap(employee)
+		require.NoError(t, err)
+		require.NoError(t, encoder.WriteElement(row))
+	}
+	require.NoError(t, encoder.EndArray())
+	require.NoError(t, encoder.Close())
+
+	assert.Equal(t, expected, out.String())
+}
+
+func TestEncoderUndeclaredArraySize(t *testing.T) {
+	schema, err := parseSchema("tags: string[]\nrows: {id:int|name:string}[]")
+	require.NoError(t, err)
+
+	var out strings.Builder
+	encoder := NewEncoder(&out, schema)
+	require.NoError(t, encoder.BeginArray("tags", -1))
+	for _, tag := range []string{"a", "b", "c"} {
+		require.NoError(t, encoder.WriteElement(tag))
+	}
+	require.NoError(t, encoder.EndArray())
+
+	require.NoError(t, encoder.BeginArray("rows", -1))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, encoder.WriteElement(map[string]interface{}{"id": i, "name": fmt.Sprintf("row-%d", i)}))
+	}
+	require.NoError(t, encoder.EndArray())
+	require.NoError(t, encoder.Close())
+
+	assert.Contains(t, out.String(), "tags[3]: a|b|c\n")
+	assert.Contains(t, out.String(), "rows[5]:\n    0|row-0\n")
+
+	parsed, err := NewParser().ParseMetaDat(out.String())
+	require.NoError(t, err)
+	assert.Len(t, parsed["rows"], 5)
+	assert.Equal(t, map[string]interface{}{"id": 4, "name": "row-4"}, parsed["rows"].([]interface{})[4])
+}
+
+func TestEncoderErrors(t *testing.T) {
+	schema, err := parseSchema("name: string\nids: int[]")
+	require.NoError(t, err)
+
+	encoder := NewEncoder(io.Discard, schema)
+	require.NoError(t, encoder.BeginArray("ids", 2))
+	require.NoError(t, encoder.WriteElement(1))
+	err = encoder.EndArray()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "array size mismatch: declared 2, found 1 elements")
+
+	encoder = NewEncoder(io.Discard, schema)
+	require.NoError(t, encoder.BeginArray("ids", 1))
+	require.NoError(t, encoder.WriteElement(1))
+	assert.Error(t, encoder.WriteElement(2))
+
+	encoder = NewEncoder(io.Discard, schema)
+	assert.Error(t, encoder.BeginArray("name", 1))
+
+	encoder = NewEncoder(io.Discard, schema)
+	err = encoder.WriteField("missing", 1)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown field: missing")
+
+	encoder = NewEncoder(io.Discard, schema)
+	require.NoError(t, encoder.BeginArray("ids", -1))
+	err = encoder.Close()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "array field ids was not ended")
+
+	// Spool files of undeclared-size arrays are removed when the encoder fails
+	spoolDir := t.TempDir()
+	t.Setenv("TMPDIR", spoolDir)
+	encoder = NewEncoder(io.Discard, schema)
+	require.NoError(t, encoder.BeginArray("ids", -1))
+	require.NoError(t, encoder.WriteElement(1))
+	assert.Error(t, encoder.WriteElement("x"))
+	assert.Error(t, encoder.EndArray())
+	assert.Error(t, encoder.Close())
+	spooled, err := os.ReadDir(spoolDir)
+	require.NoError(t, err)
+	assert.Empty(t, spooled)
+
+	encoder = NewEncoder(io.Discard, schema)
+	require.NoError(t, encoder.BeginArray("ids", -1))
+	assert.Error(t, encoder.Close())
+	spooled, err = os.ReadDir(spoolDir)
+	require.NoError(t, err)
+	assert.Empty(t, spooled)
+}
+
+func TestQuotedStringsRoundTrip(t *testing.T) {
+	schema, err := parseSchema(`text: string
+list: string[]
+pair: {left:string|right:string}
+memo: {note:string|id:string}
+solo: {s:string}
+rows: {id:int|note:string}[]`)
+	require.NoError(t, err)
+
+	roundTrip := func(s string) map[string]interface{} {
+		data := map[string]interface{}{
+			"text": s,
+			"list": []interface{}{s, "plain", s},
+			"pair": map[string]interface{}{"left": s, "right": s},
+			"memo": map[string]interface{}{"note": s, "id": "x"},
+			"solo": map[string]interface{}{"s": s},
+			"rows": []interface{}{
+				map[string]interface{}{"id": 1, "note": s},
+				map[string]interface{}{"id": 2, "note": "x"},
+			},
+		}
+
+		writer := NewWriter()
+		writer.SetSchema(schema)
+		content, err := writer.WriteMetaDat(data)
+		require.NoError(t, err)
+
+		parsed, err := NewParser().ParseMetaDat(content)
+		require.NoError(t, err, "content:\n%s", content)
+		return parsed
+	}
+
+	tricky := []string{
+		"", " ", "a|b", "|", "||", "line1\nline2", "\r\n", "  leading", "trailing  ",
+		`"quoted"`, `"`, `\`, `a\|b`, "tab\there", "null", "héllo wörld", "日本語|テキスト",
+		"emoji 😀|", "\x00\x01", "\xff\xfe invalid utf-8", "data", "meta", "name: value",
+		"note: hello", "left: value", "s: y", "s:y|z",
+	}
+	for _, s := range tricky {
+		parsed := roundTrip(s)
+		assert.Equal(t, s, parsed["text"], "string %q", s)
+		assert.Equal(t, []interface{}{s, "plain", s}, parsed["list"], "string %q", s)
+		assert.Equal(t, map[string]interface{}{"left": s, "right": s}, parsed["pair"], "string %q", s)
+		assert.Equal(t, map[string]interface{}{"note": s, "id": "x"}, parsed["memo"], "string %q", s)
+		assert.Equal(t, map[string]interface{}{"s": s}, parsed["solo"], "string %q", s)
+		rows := parsed["rows"].([]interface{})
+		assert.Equal(t, s, rows[0].(map[string]interface{})["note"], "string %q", s)
+		assert.Equal(t, 2, rows[1].(map[string]interface{})["id"], "string %q", s)
+	}
+
+	property := func(s string) bool {
+		parsed := roundTrip(s)
+		return parsed["text"] == s && reflect.DeepEqual(parsed["pair"], map[string]interface{}{"left": s, "right": s})
+	}
+	assert.NoError(t, quick.Check(property, &quick.Config{MaxCount: 500}))
+}
+
+func TestParseQuotedValues(t *testing.T) {
+	content := `meta
+    tags: string[]
+    item: {id:int|label:string|extra:string}
+data
+    tags[3]: "a|b"|c|" d "
+    item:
+        7|"x|y"|`
+
+	parsed, err := NewParser().ParseMetaDat(content)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"a|b", "c", " d "}, parsed["tags"])
+
+	// The trailing empty position leaves the field absent
+	assert.Equal(t, map[string]interface{}{"id": 7, "label": "x|y"}, parsed["item"])
+
+	_, err = NewParser().ParseMetaDat("meta\n    name: string\ndata\n    name: \"unterminated\n")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid quoted string")
+
+	_, err = NewParser().ParseMetaDat("meta\n    item: {a:int|b:int}\ndata\n    item: 1|2|3\n")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "too many values: expected 2, found 3")
+}
+
+func TestBlockStringsRoundTrip(t *testing.T) {
+	schema, err := parseSchema("description: string\ncount: int")
+	require.NoError(t, err)
+
+	values := []string{
+		"line one\nline two",
+		"SELECT *\n  FROM orders\n WHERE total > 10;\n",
+		"first\n\n\nafter blank lines",
+		"trailing newlines\n\n\n",
+		"\nleading newline",
+		"tabs\tinside\n\tand indented",
+		"unicode ✓\n日本語",
+	}
+
+	for _, value := range values {
+		writer := NewWriter()
+		writer.SetSchema(schema)
+		content, err := writer.WriteMetaDat(map[string]interface{}{"description": value, "count": 3})
+		require.NoError(t, err)
+		assert.Contains(t, content, "description: |", "value %q", value)
+
+		parsed, err := NewParser().ParseMetaDat(content)
+		require.NoError(t, err, "content:\n%s", content)
+		assert.Equal(t, value, parsed["description"], "content:\n%s", content)
+		assert.Equal(t, 3, parsed["count"])
+	}
+
+	// Strings a block cannot represent exactly fall back to quoting
+	for _, value := range []string{"  indented first line\nsecond", "carriage\r\nreturn", "spaces only\n   \nline"} {
+		writer := NewWriter()
+		writer.SetSchema(schema)
+		content, err := writer.WriteMetaDat(map[string]interface{}{"description": value})
+		require.NoError(t, err)
+		assert.NotContains(t, content, "description: |")
+
+		parsed, err := NewParser().ParseMetaDat(content)
+		require.NoError(t, err)
+		assert.Equal(t, value, parsed["description"])
+	}
+}
+
+func TestParseBlockStrings(t *testing.T) {
+	content := `meta
+    address: string
+    notes: string
+    kept: string
+    contact: {name:string|bio:string}
+data
+  address: |
+    12 Main St
+
+    Springfield
+  notes: |-
+    no trailing newline
+  kept: |+
+    keep
+
+  contact:
+    name: Ann
+    bio: |
+      Line A
+        indented B`
+
+	parsed, err := NewParser().ParseMetaDat(content)
+	require.NoError(t, err)
+	assert.Equal(t, "12 Main St\n\nSpringfield\n", parsed["address"])
+	assert.Equal(t, "no trailing newline", parsed["notes"])
+	assert.Equal(t, "keep\n\n", parsed["kept"])
+	assert.Equal(t, map[string]interface{}{"name": "Ann", "bio": "Line A\n  indented B\n"}, parsed["contact"])
+}
+
+func TestParseTypedSimpleArrays(t *testing.T) {
+	content := `meta
+    ids: int[]
+    weights: float32[]
+    ratios: float64[]
+    flags: bool[]
+data
+    ids[3]: 1|2|3
+    weights[2]: 1.5|2
+    ratios[2]:
+        0.25
+        1e3
+    flags[2]: true|false`
+
+	parsed, err := NewParser().ParseMetaDat(content)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{1, 2, 3}, parsed["ids"])
+	assert.Equal(t, []interface{}{float32(1.5), float32(2)}, parsed["weights"])
+	assert.Equal(t, []interface{}{0.25, 1000.0}, parsed["ratios"])
+	assert.Equal(t, []interface{}{true, false}, parsed["flags"])
+
+	jsonStr, err := ConvertMetaDatToJSON(content)
+	require.NoError(t, err)
+	assert.Contains(t, jsonStr, "\"ids\": [\n    1,\n    2,\n    3\n  ]")
+
+	_, err = NewParser().ParseMetaDat("meta\n    ids: int[]\ndata\n    ids[3]: 1|two|3\n")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 4, column 15: field ids[1]: invalid integer value: two")
+
+	_, err = NewParser().ParseMetaDat("meta\n    flags: bool[]\ndata\n    flags[2]:\n        true\n        maybe\n")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 6, column 9: field flags[1]: invalid boolean value: maybe")
+}
+
+func TestNestedValuesRoundTrip(t *testing.T) {
+	schema, err := parseSchema(`
+    company: {name:string|address:{street:string|geo:{lat:float64|lng:float64}}|tags:string[]}
+    teams: {name:string|members:{name:string|roles:string[]}[]}[]
+    matrix: int[][]`)
+	require.NoError(t, err)
+
+	data := map[string]interface{}{
+		"company": map[string]interface{}{
+			"name": "Acme | Co",
+			"address": map[string]interface{}{
+				"street": "1 Main St",
+				"geo":    map[string]interface{}{"lat": 13.75, "lng": 100.5},
+			},
+			"tags": []interface{}{"b2b", "[beta]", ""},
+		},
+		"teams": []interface{}{
+			map[string]interface{}{
+				"name": "core",
+				"members": []interface{}{
+					map[string]interface{}{"name": "Ann", "roles": []interface{}{"lead", "dev"}},
+					map[string]interface{}{"name": "Bo", "roles": []interface{}{}},
+				},
+			},
+			map[string]interface{}{"name": "empty", "members": []interface{}{}},
+		},
+		"matrix": []interface{}{[]interface{}{1, 2}, []interface{}{3}},
+	}
+
+	writer := NewWriter()
+	writer.SetSchema(schema)
+	content, err := writer.WriteMetaDat(data)
+	require.NoError(t, err)
+	assert.Contains(t, content, `"Acme | Co"|{1 Main St|{13.75|100.5}}|[b2b|"[beta]"|""]`)
+
+	parsed, err := NewParser().ParseMetaDat(content)
+	require.NoError(t, err)
+	assert.Equal(t, data, parsed)
+
+	// Empty nested objects are written as {} and read back as empty objects
+	jsonStr := `{"o":{"a":{},"b":1},"p":{"q":{"r":{}}}}`
+	metadatStr, err := ConvertJSONToMetaDat(jsonStr)
+	require.NoError(t, err)
+	assert.Contains(t, metadatStr, "o:\n    {}|1\n")
+	backToJSON, err := ConvertMetaDatToJSON(metadatStr)
+	require.NoError(t, err)
+	assert.JSONEq(t, jsonStr, backToJSON)
+
+	_, err = NewParser().ParseMetaDat("meta\n    o: {a:{x!:int}|b:int}\ndata\n    o: {}|1\n")
+	assert.EqualError(t, err, "line 4, column 9: field o.a.x: missing required field")
+}
+
+func TestParseNestedValues(t *testing.T) {
+	content := `meta
+    user: {name:string|profile:{age:int|emails:string[]}}
+data
+    user:
+        Ann|{30|[a@x.io|"b|c@x.io"]}`
+
+	parsed, err := NewParser().ParseMetaDat(content)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":    "Ann",
+		"profile": map[string]interface{}{"age": 30, "emails": []interface{}{"a@x.io", "b|c@x.io"}},
+	}, parsed["user"])
+
+	// Absent nested fields are left out
+	parsed, err = NewParser().ParseMetaDat("meta\n    user: {name:string|profile:{age:int|emails:string[]}}\ndata\n    user: Ann|{|[]}\n")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":    "Ann",
+		"profile": map[string]interface{}{"emails": []interface{}{}},
+	}, parsed["user"])
+
+	_, err = NewParser().ParseMetaDat("meta\n    user: {name:string|profile:{age:int}}\ndata\n    user: Ann|30\n")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 4, column 15: field user.profile: invalid object value: 30")
+
+	_, err = NewParser().ParseMetaDat("meta\n    user: {name:string|profile:{age:int}}\ndata\n    user: Ann|{old}\n")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 4, column 16: field user.profile.age: invalid integer value: old")
+}
+
+func TestMultiDimensionalArrays(t *testing.T) {
+	schema, err := parseSchema(`
+    matrix: int[][]
+    cube: string[][][]
+    groups: {name:string|score:float64}[][]`)
+	require.NoError(t, err)
+
+	data := map[string]interface{}{
+		"matrix": []interface{}{[]interface{}{1, 2, 3}, []interface{}{}, []interface{}{4}},
+		"cube": []interface{}{
+			[]interface{}{[]interface{}{"a", "b|c"}, []interface{}{""}},
+			[]interface{}{},
+		},
+		"groups": []interface{}{
+			[]interface{}{
+				map[string]interface{}{"name": "x", "score": 1.5},
+				map[string]interface{}{"name": "y", "score": 2.0},
+			},
+			[]interface{}{map[string]interface{}{"name": "z", "score": 0.5}},
+		},
+	}
+
+	writer := NewWriter()
+	writer.SetSchema(schema)
+	content, err := writer.WriteMetaDat(data)
+	require.NoError(t, err)
+	assert.Contains(t, content, "matrix[3]:\n    [3]: 1|2|3\n    [0]:\n    [1]: 4\n")
+	assert.Contains(t, content, "cube[2]:\n    [2]:\n        [2]: a|\"b|c\"\n        [1]: \"\"\n    [0]:\n")
+	assert.Contains(t, content, "groups[2]:\n    [2]:\n        x|1.5\n        y|2\n    [1]:\n        z|0.5\n")
+
+	parsed, err := NewParser().ParseMetaDat(content)
+	require.NoError(t, err)
+	assert.Equal(t, data, parsed)
+
+	var target struct {
+		Matrix [][]int `metadat:"matrix"`
+	}
+	require.NoError(t, Unmarshal([]byte(content), &target))
+	assert.Equal(t, [][]int{{1, 2, 3}, {}, {4}}, target.Matrix)
+
+	// Streaming writes nested arrays element by element
+	var buf strings.Builder
+	encoder := NewDataEncoder(&buf, schema)
+	require.NoError(t, encoder.BeginArray("matrix", -1))
+	require.NoError(t, encoder.WriteElement([]int{5, 6}))
+	require.NoError(t, encoder.WriteElement([]int{7}))
+	require.NoError(t, encoder.EndArray())
+	require.NoError(t, encoder.Close())
+	assert.Equal(t, "matrix[2]:\n    [2]: 5|6\n    [1]: 7\n", buf.String())
+}
+
+func TestParseMultiDimensionalArrayErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		errMsg  string
+	}{
+		{
+			name:    "inner size mismatch",
+			content: "meta\n    matrix: int[][]\ndata\n    matrix[2]:\n        [2]: 1|2\n        [3]: 3|4\n",
+			errMsg:  "line 6, column 14: field matrix[1]: array size mismatch: declared 3, found 2 elements",
+		},
+		{
+			name:    "deep size mismatch",
+			content: "meta\n    cube: int[][][]\ndata\n    cube[1]:\n        [1]:\n            [2]:\n                1\n",
+			errMsg:  "line 6, column 13: field cube[0][0]: array size mismatch: declared 2, found 1 elements",
+		},
+		{
+			name:    "outer size mismatch",
+			content: "meta\n    matrix: int[][]\ndata\n    matrix[3]:\n        [1]: 1\n        [1]: 2\n",
+			errMsg:  "array size mismatch: declared 3, found 2 elements",
+		},
+		{
+			name:    "invalid inner element",
+			content: "meta\n    matrix: int[][]\ndata\n    matrix[1]:\n        [2]: 1|x\n",
+			errMsg:  "line 5, column 16: field matrix[0][1]: invalid integer value: x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser().ParseMetaDat(tt.content)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+}
+
+func TestNullableValuesRoundTrip(t *testing.T) {
+	schema, err := parseSchema(`
+    name: string?
+    nickname: string?
+    age: int?
+    scores: int?[]
+    tags: string[]?
+    owner: {id:int|email:string?}?
+    contacts: {id:int|email:string?}[]`)
+	require.NoError(t, err)
+	assert.Contains(t, schema.ToString(), "scores: int?[]")
+	assert.Contains(t, schema.ToString(), "tags: string[]?")
+	assert.Contains(t, schema.ToString(), "owner: {id:int|email:string?}?")
+
+	data := map[string]interface{}{
+		"name":     nil,
+		"nickname": "null",
+		"age":      nil,
+		"scores":   []interface{}{1, nil, 3},
+		"tags":     nil,
+		"owner":    nil,
+		"contacts": []interface{}{
+			map[string]interface{}{"id": 1, "email": nil},
+			map[string]interface{}{"id": 2, "email": ""},
+		},
+	}
+
+	writer := NewWriter()
+	writer.SetSchema(schema)
+	content, err := writer.WriteMetaDat(data)
+	require.NoError(t, err)
+	assert.Contains(t, content, "name: null\n")
+	assert.Contains(t, content, "nickname:\n    \"null\"\n")
+	assert.Contains(t, content, "scores[3]: 1|null|3\n")
+	assert.Contains(t, content, "tags: null\n")
+	assert.Contains(t, content, "contacts[2]:\n    1|null\n    2|\"\"\n")
+
+	parsed, err := NewParser().ParseMetaDat(content)
+	require.NoError(t, err)
+	assert.Equal(t, data, parsed)
+	require.NoError(t, schema.ValidateData(parsed))
+
+	// A missing field stays absent, an empty slot is absent and null is nil
+	parsed, err = NewParser().ParseMetaDat("meta\n    contact: {id:int|email:string?|phone:string?}\ndata\n    contact: 1||null\n")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": 1, "phone": nil}, parsed["contact"])
+
+	// An object whose only field is null is told apart from a null object by braces
+	schema, err = parseSchema("    rows: {a:string?}?[]\n    one: {a:string?}?\n    nested: {o:{x:int}}[]")
+	require.NoError(t, err)
+	data = map[string]interface{}{
+		"rows":   []interface{}{map[string]interface{}{"a": nil}, nil, map[string]interface{}{"a": "x"}},
+		"one":    map[string]interface{}{"a": nil},
+		"nested": []interface{}{map[string]interface{}{"o": map[string]interface{}{"x": 1}}},
+	}
+	writer.SetSchema(schema)
+	content, err = writer.WriteMetaDat(data)
+	require.NoError(t, err)
+	assert.Contains(t, content, "rows[3]:\n    {null}\n    null\n    x\n")
+	assert.Contains(t, content, "one:\n    {null}\n")
+	assert.Contains(t, content, "nested[1]:\n    {{1}}\n")
+	parsed, err = NewParser().ParseMetaDat(content)
+	require.NoError(t, err)
+	assert.Equal(t, data, parsed)
+}
+
+func TestNullForNonNullableTypes(t *testing.T) {
+	// Without the nullable marker an unquoted null is an ordinary string
+	parsed, err := NewParser().ParseMetaDat("meta\n    name: string\ndata\n    name: null\n")
+	require.NoError(t, err)
+	assert.Equal(t, "null", parsed["name"])
+
+	_, err = NewParser().ParseMetaDat("meta\n    age: int\ndata\n    age: null\n")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid integer value: null")
+
+	schema, err := parseSchema("    age: int\n    ids: int[]")
+	require.NoError(t, err)
+	writer := NewWriter()
+	writer.SetSchema(schema)
+	_, err = writer.WriteMetaDat(map[string]interface{}{"age": nil})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "null value for non-nullable field age")
+	_, err = writer.WriteMetaDat(map[string]interface{}{"ids": []interface{}{1, nil}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "element 1: null value for non-nullable type int")
+
+	err = schema.ValidateData(map[string]interface{}{"age": nil})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "null value for non-nullable type int")
+
+	_, err = parseType("int??")
+	require.Error(t, err)
+}
+
+func TestNullJSONConversion(t *testing.T) {
+	jsonStr := `{"name": "Ann", "manager": null}`
+	content, err := ConvertJSONToMetaDat(jsonStr)
+	require.NoError(t, err)
+	assert.Contains(t, content, "manager: string?")
+	assert.Contains(t, content, "manager: null")
+
+	back, err := ConvertMetaDatToJSON(content)
+	require.NoError(t, err)
+	assert.JSONEq(t, jsonStr, back)
+
+	type Team struct {
+		Name *string `json:"name"`
+		Lead *User   `json:"lead"`
+	}
+	writer := NewWriter()
+	structContent, err := writer.WriteStruct(Team{})
+	require.NoError(t, err)
+	assert.Contains(t, structContent, "name: null\n")
+	assert.Contains(t, structContent, "lead: null\n")
+
+	decoded := Team{Name: new(string)}
+	require.NoError(t, Unmarshal([]byte(structContent), &decoded))
+	assert.Nil(t, decoded.Name)
+	assert.Nil(t, decoded.Lead)
+}
+
+func TestRequiredFields(t *testing.T) {
+	schema, err := parseSchema(`
+    id!: int
+    name: string
+    owner!: {id!:int|email:string}
+    members: {id!:int|email:string}[]`)
+	require.NoError(t, err)
+	assert.True(t, schema.Fields["id"].Required)
+	assert.False(t, schema.Fields["name"].Required)
+	assert.True(t, schema.Fields["owner"].ObjectFields["id"].Required)
+	assert.Contains(t, schema.ToString(), "    id!: int\n")
+	assert.Contains(t, schema.ToString(), "    owner!: {id!:int|email:string}\n")
+
+	valid := map[string]interface{}{
+		"id":      1,
+		"owner":   map[string]interface{}{"id": 2},
+		"members": []interface{}{map[string]interface{}{"id": 3, "email": "a@x.io"}},
+	}
+	require.NoError(t, schema.ValidateData(valid))
+
+	tests := []struct {
+		name   string
+		data   map[string]interface{}
+		errMsg string
+	}{
+		{
+			name:   "missing top-level field",
+			data:   map[string]interface{}{"owner": map[string]interface{}{"id": 2}},
+			errMsg: "field id: missing required field",
+		},
+		{
+			name:   "missing nested field",
+			data:   map[string]interface{}{"id": 1, "owner": map[string]interface{}{"email": "a@x.io"}},
+			errMsg: "field owner.id: missing required field",
+		},
+		{
+			name: "missing field in array element",
+			data: map[string]interface{}{
+				"id":      1,
+				"owner":   map[string]interface{}{"id": 2},
+				"members": []interface{}{map[string]interface{}{"id": 3}, map[string]interface{}{}},
+			},
+			errMsg: "field members[1].id: missing required field",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schema.ValidateData(tt.data)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+}
+
+func TestParseRequiredFields(t *testing.T) {
+	parser := NewParser()
+	require.NoError(t, parser.ParseSchema("    id!: int\n    owner: {id!:int|email:string}\n    members: {id!:int|email:string}[]"))
+
+	_, err := parser.ParseData("    id: 1\n    owner: 2|b@x.io\n")
+	require.NoError(t, err)
+
+	_, err = parser.ParseData("    owner: 2|b@x.io\n")
+	require.Error(t, err)
+	assert.Equal(t, "field id: missing required field", err.Error())
+
+	_, err = parser.ParseData("    id: 1\n    owner: |b@x.io\n")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2, column 12: field owner.id: missing required field")
+
+	_, err = parser.ParseData("    id: 1\n    owner:\n        email: b@x.io\n")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2: field owner.id: missing required field")
+
+	_, err = parser.ParseData("    id: 1\n    members[2]:\n        1|a@x.io\n        |b@x.io\n")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 4, column 9: field members[1].id: missing required field")
+
+	type Account struct {
+		ID    int    `metadat:"id,required"`
+		Email string `json:"email,omitempty"`
+	}
+	writer := NewWriter()
+	content, err := writer.WriteStruct(Account{ID: 7})
+	require.NoError(t, err)
+	assert.Contains(t, content, "id!: int")
+	assert.Contains(t, content, "email: string")
+
+	// Names ending in "!" are quoted so they do not read back as required fields
+	jsonStr := `{"wow!":1,"o":{"x!":"y","z":2},"r":[{"a!":1}]}`
+	content, err = ConvertJSONToMetaDat(jsonStr)
+	require.NoError(t, err)
+	assert.Contains(t, content, "    \"wow!\": int\n    o: {\"x!\":string|z:int}\n    r: {\"a!\":int}[]\n")
+	back, err := ConvertMetaDatToJSON(content)
+	require.NoError(t, err)
+	assert.JSONEq(t, jsonStr, back)
+
+	require.NoError(t, parser.ParseSchema("    \"wow!\"!: int\n    other: int"))
+	_, err = parser.ParseData("    other: 1\n")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "field wow!: missing required field")
+}
+
+func TestArrayDocuments(t *testing.T) {
+	content := `meta
+    []: {id!:int|name:string|tags:string[]}
+data
+    [3]:
+        1|Ann|[admin]
+        2|"Bo | Jr"|[]
+        3||[x|y]`
+
+	parser := NewParser()
+	records, err := parser.ParseArray(content)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"id": 1, "name": "Ann", "tags": []interface{}{"admin"}},
+		map[string]interface{}{"id": 2, "name": "Bo | Jr", "tags": []interface{}{}},
+		map[string]interface{}{"id": 3, "tags": []interface{}{"x", "y"}},
+	}, records)
+
+	writer := NewWriter()
+	writer.SetSchema(parser.schema)
+	written, err := writer.WriteArray(records)
+	require.NoError(t, err)
+	assert.Contains(t, written, "meta\n    []: {id!:int|name:string|tags:string[]}\n")
+	assert.Contains(t, written, "data\n[3]:\n    1|Ann|[admin]\n")
+
+	reparsed, err := NewParser().ParseArray(written)
+	require.NoError(t, err)
+	assert.Equal(t, records, reparsed)
+
+	// Streaming reads the rows one at a time
+	decoder := NewDecoder(strings.NewReader(content))
+	var kinds []TokenKind
+	for decoder.Next() {
+		kinds = append(kinds, decoder.Token().Kind)
+	}
+	require.NoError(t, decoder.Err())
+	assert.Equal(t, []TokenKind{ArrayStartToken, ElementToken, ElementToken, ElementToken, ArrayEndToken}, kinds)
+
+	schemaOnly := NewParser()
+	require.NoError(t, schemaOnly.ParseSchema("    []: int"))
+	values, err := schemaOnly.ParseArrayData("[3]: 1|2|3\n")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{1, 2, 3}, values)
+
+	_, err = NewParser().ParseMetaDat(content)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "document root is an array, use ParseArray")
+
+	_, err = NewParser().ParseArray("meta\n    id: int\ndata\n    id: 1\n")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "document root is not an array")
+
+	_, err = parseSchema("    []: {id:int}\n    count: int")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "an array document cannot declare other fields")
+
+	_, err = NewParser().ParseArray("meta\n    []: {id!:int|name:string}\ndata\n[1]:\n    |Ann\n")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 5, column 5: element [0].id: missing required field")
+}
+
+func TestArrayDocumentConversions(t *testing.T) {
+	jsonStr := `[{"id": 1, "name": "Ann"}, {"id": 2, "name": "Bo"}]`
+	content, err := ConvertJSONToMetaDat(jsonStr)
+	require.NoError(t, err)
+	assert.Equal(t, "meta\n    []: {id:int|name:string}\n\ndata\n[2]:\n    1|Ann\n    2|Bo\n", content)
+
+	back, err := ConvertMetaDatToJSON(content)
+	require.NoError(t, err)
+	assert.JSONEq(t, jsonStr, back)
+
+	content, err = ConvertJSONToMetaDat(`[]`)
+	require.NoError(t, err)
+	back, err = ConvertMetaDatToJSON(content)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[]`, back)
+
+	_, err = ConvertJSONToMetaDat(`42`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "JSON must be an object or an array at root level")
+
+	employees := []Employee{{ID: 1, Name: "Ann", Role: "dev", Salary: 10}, {ID: 2, Name: "Bo", Role: "ops", Salary: 12.5}}
+	writer := NewWriter()
+	structContent, err := writer.WriteStruct(employees)
+	require.NoError(t, err)
+	assert.Contains(t, structContent, "[]: {id:int|name:string|role:string|salary:float64}")
+
+	var decoded []Employee
+	require.NoError(t, Unmarshal([]byte(structContent), &decoded))
+	assert.Equal(t, employees, decoded)
+}
+
+func TestJSONInferenceKeepsSourceOrder(t *testing.T) {
+	jsonStr := `{"zeta": 1, "alpha": {"y": "a", "b": true, "m": [{"k2": 1, "k1": 2}]}, "mid": "x", "alpha2": null}`
+
+	first, err := ConvertJSONToMetaDat(jsonStr)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(first, "meta\n    zeta: int\n    alpha: {y:string|b:bool|m:{k2:int|k1:int}[]}\n    mid: string\n    alpha2: string?\n"))
+	assert.Contains(t, first, "alpha:\n    a|true|[{1|2}]\n")
+
+	for i := 0; i < 20; i++ {
+		again, err := ConvertJSONToMetaDat(jsonStr)
+		require.NoError(t, err)
+		require.Equal(t, first, again)
+	}
+
+	data, schema, err := DecodeJSON([]byte(jsonStr))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"zeta", "alpha", "mid", "alpha2"}, schema.FieldOrder)
+	var expected interface{}
+	require.NoError(t, json.Unmarshal([]byte(jsonStr), &expected))
+	assert.Equal(t, expected, data)
+
+	// Plain maps have no source order, so keys are sorted
+	mapSchema := InferSchemaFromJSON(expected)
+	assert.Equal(t, []string{"alpha", "alpha2", "mid", "zeta"}, mapSchema.FieldOrder)
+	assert.Equal(t, []string{"b", "m", "y"}, mapSchema.Fields["alpha"].ObjectOrder)
+
+	_, _, err = DecodeJSON([]byte(`{"a": 1} {"b": 2}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid JSON")
+	_, _, err = DecodeJSON([]byte(`{"a": `))
+	require.Error(t, err)
+}
+
+func TestInferSchemaMergesArrayElements(t *testing.T) {
+	jsonStr := `{"items": [
+		{"id": 1, "price": 10},
+		{"id": 2, "price": 10.5, "note": "sale"},
+		{"id": 3, "price": null, "tags": ["a"]},
+		{"id": 4, "tags": []}
+	], "matrix": [[1, 2], [], [3.5]], "empty": []}`
+
+	content, err := ConvertJSONToMetaDat(jsonStr)
+	require.NoError(t, err)
+	assert.Contains(t, content, "items: {id:int|price:float64?|note:string|tags:string[]}[]")
+	assert.Contains(t, content, "matrix: float64[][]")
+	assert.Contains(t, content, "empty: string[]")
+	assert.Contains(t, content, "items[4]:\n    1|10||\n    2|10.5|sale|\n    3|null||[a]\n    4|||[]\n")
+
+	back, err := ConvertMetaDatToJSON(content)
+	require.NoError(t, err)
+	assert.JSONEq(t, jsonStr, back)
+
+	content, err = ConvertJSONToMetaDat(`[{"a":1},{}]`)
+	require.NoError(t, err)
+	assert.Contains(t, content, "[2]:\n    1\n    {}\n")
+	back, err = ConvertMetaDatToJSON(content)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"a":1},{}]`, back)
+
+	_, err = ConvertJSONToMetaDat(`{"items": [{"id": 1}, {"id": "two"}]}`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "conflicting types for field items[1].id: int and string")
+
+	_, err = ConvertJSONToMetaDat(`[[1], {"a": 1}]`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "conflicting types for element [1]: int[] and {a:int}")
+}
+
+func TestInferSchemaFromSamples(t *testing.T) {
+	var first, second interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"id": 1, "user": {"name": "Ann"}}`), &first))
+	require.NoError(t, json.Unmarshal([]byte(`{"id": 2.5, "user": {"name": "Bo", "age": 30}, "extra": null}`), &second))
+
+	schema, err := InferSchemaFromSamples(first, second)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "user", "extra"}, schema.FieldOrder)
+	assert.Equal(t, "float64", schema.Fields["id"].Type)
+	assert.Equal(t, "{name:string|age:int}", fieldTypeToString(schema.Fields["user"]))
+	assert.Equal(t, "string?", fieldTypeToString(schema.Fields["extra"]))
+
+	var third interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"id": 3, "user": "Cy"}`), &third))
+	_, err = InferSchemaFromSamples(first, second, third)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "sample 2: conflicting types for field user: {name:string|age:int} and string")
+
+	// InferSchemaFromJSON skips values whose type conflicts
+	var conflicting interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"ids": [1, "x", 2.5]}`), &conflicting))
+	assert.Equal(t, "float64[]", fieldTypeToString(InferSchemaFromJSON(conflicting).Fields["ids"]))
+}
+
+func TestStructuredErrors(t *testing.T) {
+	content := "meta\n    name: string\n    orders: {id:int|total:float64}[]\ndata\n    name: Ann\n    orders[4]:\n        1|2.5\n        2|3\n        3|4\n        4|abc\n"
+	_, err := NewParser().ParseMetaDat(content)
+	require.Error(t, err)
+	var typeErr *TypeError
+	require.True(t, errors.As(err, &typeErr))
+	assert.Equal(t, Position{Line: 10, Column: 11, Path: "orders[3].total"}, typeErr.Position)
+	assert.Equal(t, "abc", typeErr.Text)
+	assert.Equal(t, "float64", typeErr.Type)
+	assert.Equal(t, "line 10, column 11: field orders[3].total: invalid float64 value: abc", err.Error())
+
+	// Schema errors use line numbers of the complete document
+	_, err = NewParser().ParseMetaDat("meta\n    name: string\n    age: integer\ndata\n    name: Ann\n")
+	var schemaErr *SchemaError
+	require.True(t, errors.As(err, &schemaErr))
+	assert.Equal(t, Position{Line: 3, Column: 10, Path: "age"}, schemaErr.Position)
+	assert.Equal(t, "integer", schemaErr.Text)
+
+	_, err = NewParser().ParseMetaDat("meta\n    name: string\ndata\n    name: Ann\n    nickname: A\n")
+	require.True(t, errors.As(err, &schemaErr))
+	assert.Equal(t, Position{Line: 5, Column: 5, Path: "nickname"}, schemaErr.Position)
+	assert.Equal(t, "unknown field", schemaErr.Msg)
+
+	_, err = NewParser().ParseMetaDat("meta\n    ids: int[]\ndata\n    ids[3]: 1|2\n")
+	require.True(t, errors.As(err, &schemaErr))
+	assert.Equal(t, Position{Line: 4, Column: 13, Path: "ids"}, schemaErr.Position)
+
+	var syntaxErr *SyntaxError
+	_, err = NewParser().ParseMetaDat("meta\n    name: string\ndata\n    name: Ann\n    oops\n")
+	require.True(t, errors.As(err, &syntaxErr))
+	assert.Equal(t, Position{Line: 5, Column: 5}, syntaxErr.Position)
+	assert.Equal(t, "oops", syntaxErr.Text)
+
+	_, err = NewParser().ParseMetaDat("meta\n    user: {name:string|tags:string[]}\ndata\n    user: Ann|[a|\"b]\n")
+	require.True(t, errors.As(err, &syntaxErr))
+	assert.Equal(t, Position{Line: 4, Column: 18, Path: "user.tags[1]"}, syntaxErr.Position)
+
+	// Separated files report lines of the file the error was found in
+	dir := t.TempDir()
+	schemaFile := dir + "/schema.metadat"
+	dataFile := dir + "/data.metadat"
+	require.NoError(t, os.WriteFile(schemaFile, []byte("    id: int\n    tags: string[]\n"), 0644))
+	require.NoError(t, os.WriteFile(dataFile, []byte("    id: 1\n    tags[2]:\n        a\n        b\n        c\n"), 0644))
+	_, err = NewParser().ParseFromFiles(schemaFile, dataFile)
+	require.True(t, errors.As(err, &schemaErr))
+	assert.Equal(t, Position{Line: 2, Path: "tags"}, schemaErr.Position)
+	assert.Equal(t, "line 2: field tags: array size mismatch: declared 2, found 3 elements", err.Error())
+
+	require.NoError(t, os.WriteFile(schemaFile, []byte("    id: int\n    tags: strings[]\n"), 0644))
+	_, err = NewParser().ParseFromFiles(schemaFile, dataFile)
+	require.True(t, errors.As(err, &schemaErr))
+	assert.Equal(t, Position{Line: 2, Column: 11, Path: "tags"}, schemaErr.Position)
+}
+
+func TestCollectErrors(t *testing.T) {
+	content := "meta\n    name!: string\n    ids: int[]\n    orders: {id:int|total:float64}[]\n    age: int\ndata\n    ids[3]: 1|x|3\n    nick: A\n    orders[3]:\n        1|2.5\n        z|3\n        3|4\n        4|5\n    age: 30\n"
+
+	// By default parsing stops at the first error
+	_, err := NewParser().ParseMetaDat(content)
+	require.Error(t, err)
+	var list ErrorList
+	assert.False(t, errors.As(err, &list))
+
+	parser := NewParser()
+	parser.SetCollectErrors(true)
+	data, err := parser.ParseMetaDat(content)
+	require.True(t, errors.As(err, &list))
+	require.Len(t, list, 5)
+	assert.Equal(t, "line 7, column 15: field ids[1]: invalid integer value: x", list[0].Error())
+	assert.Equal(t, "line 8, column 5: field nick: unknown field", list[1].Error())
+	assert.Equal(t, "line 11, column 9: field orders[1].id: invalid integer value: z", list[2].Error())
+	assert.Equal(t, "line 9: field orders: array size mismatch: declared 3, found 4 elements", list[3].Error())
+	assert.Equal(t, "field name: missing required field", list[4].Error())
+	assert.Equal(t, "line 7, column 15: field ids[1]: invalid integer value: x (and 4 more errors)", err.Error())
+
+	var typeErr *TypeError
+	require.True(t, errors.As(err, &typeErr))
+	assert.Equal(t, "ids[1]", typeErr.Path)
+
+	// Fields and elements with errors are left out of the partial document
+	assert.Equal(t, map[string]interface{}{
+		"orders": []interface{}{
+			map[string]interface{}{"id": 1, "total": 2.5},
+			map[string]interface{}{"id": 3, "total": 4.0},
+		},
+		"age": 30,
+	}, data)
+
+	// A valid document has no errors
+	data, err = parser.ParseMetaDat("meta\n    name: string\ndata\n    name: Ann\n")
+	require.NoError(t, err)
+	assert.Equal(t, "Ann", data["name"])
+
+	// Every error in the meta section is reported, and the data section is not parsed
+	_, err = parser.ParseMetaDat("meta\n    name: str\n    age: int\n    tags: strings[]\ndata\n    name: Ann\n")
+	require.True(t, errors.As(err, &list))
+	require.Len(t, list, 2)
+	assert.Equal(t, "line 2, column 11: field name: unknown type: str", list[0].Error())
+	assert.Equal(t, "line 4, column 11: field tags: unknown type: strings", list[1].Error())
+
+	err = parser.ParseSchema("    name: str\n    tags: strings[]\n")
+	require.True(t, errors.As(err, &list))
+	assert.Len(t, list, 2)
+
+	// Decoders stream the valid tokens and report the errors at the end
+	decoder := NewDecoder(strings.NewReader("meta\n    ids: int[]\ndata\n    ids[3]:\n        1\n        x\n        3\n"))
+	decoder.SetCollectErrors(true)
+	var elements []interface{}
+	for decoder.Next() {
+		if tok := decoder.Token(); tok.Kind == ElementToken {
+			elements = append(elements, tok.Value)
+		}
+	}
+	assert.Equal(t, []interface{}{1, 3}, elements)
+	require.True(t, errors.As(decoder.Err(), &list))
+	require.Len(t, list, 1)
+	assert.Equal(t, "line 6, column 9: field ids[1]: invalid integer value: x", list[0].Error())
+
+	// Structs receive the partially parsed document
+	type Record struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	var record Record
+	parser = NewParser()
+	parser.SetCollectErrors(true)
+	err = parser.ParseInto("meta\n    name: string\n    age: int\ndata\n    name: Ann\n    age: old\n", &record)
+	require.Error(t, err)
+	assert.Equal(t, Record{Name: "Ann"}, record)
+}
+
+func TestValidateAll(t *testing.T) {
+	schema, err := parseSchema("    id!: int\n    scores: int[]\n    name: string")
+	require.NoError(t, err)
+
+	errs := schema.ValidateAll(map[string]interface{}{
+		"scores": []interface{}{1, "two", 3, false},
+		"name":   5,
+		"extra":  true,
+	})
+	require.Len(t, errs, 5)
+	assert.Equal(t, "field id: missing required field", errs[0].Error())
+	assert.Equal(t, "field scores[1]: expected integer, got string", errs[1].Error())
+	assert.Equal(t, "field scores[3]: expected integer, got bool", errs[2].Error())
+	assert.Equal(t, "field name: expected string, got int", errs[3].Error())
+	assert.Equal(t, "field extra: unknown field", errs[4].Error())
+
+	// ValidateData reports the first of them
+	assert.Equal(t, errs[0].Error(), schema.ValidateData(map[string]interface{}{"scores": []interface{}{"two"}}).Error())
+
+	assert.Nil(t, schema.ValidateAll(map[string]interface{}{"id": 1, "scores": []interface{}{1}}))
+	assert.NoError(t, schema.ValidateAll(map[string]interface{}{"id": 1}).Err())
+
+	// Nested values are walked all the way down, in schema order
+	schema, err = parseSchema("    orders: {id!:int|total:float64|lines:{sku:string|qty:int}[]|customer:{name!:string|email:string}}[]")
+	require.NoError(t, err)
+	data := map[string]interface{}{"orders": []interface{}{
+		map[string]interface{}{"id": 1, "total": 9.5},
+		map[string]interface{}{
+			"total":    "abc",
+			"lines":    []interface{}{map[string]interface{}{"sku": 7, "qty": "x"}},
+			"customer": map[string]interface{}{"email": false},
+		},
+	}}
+	for i := 0; i < 5; i++ {
+		errs = schema.ValidateAll(data)
+		require.Len(t, errs, 6)
+		assert.Equal(t, []string{
+			"field orders[1].id: missing required field",
+			"field orders[1].total: expected float, got string",
+			"field orders[1].lines[0].sku: expected string, got int",
+			"field orders[1].lines[0].qty: expected integer, got string",
+			"field orders[1].customer.name: missing required field",
+			"field orders[1].customer.email: expected string, got bool",
+		}, errorStrings(errs))
+	}
+
+	var typeErr *TypeError
+	require.ErrorAs(t, errs[1], &typeErr)
+	assert.Equal(t, "orders[1].total", typeErr.Path)
+	assert.Equal(t, "float64", typeErr.Type)
+	var schemaErr *SchemaError
+	require.ErrorAs(t, errs[0], &schemaErr)
+	assert.Equal(t, "orders[1].id", schemaErr.Path)
+}
+
+// errorStrings returns the messages of errs
+func errorStrings(errs []error) []string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return messages
+}
+
+func TestTemporalTypes(t *testing.T) {
+	type Shift struct {
+		Start    time.Time       `json:"start"`
+		Day      time.Time       `metadat:"day,type=date"`
+		Length   time.Duration   `json:"length"`
+		Ended    *time.Time      `json:"ended"`
+		Breaks   []time.Duration `json:"breaks"`
+		Comments string          `json:"comments"`
+	}
+
+	zone := time.FixedZone("ICT", 7*60*60)
+	shift := Shift{
+		Start:  time.Date(2024, 3, 1, 9, 30, 0, 500000000, zone),
+		Day:    time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		Length: 8*time.Hour + 30*time.Minute,
+		Breaks: []time.Duration{15 * time.Minute, time.Hour},
+	}
+
+	schema, err := InferSchemaFromStruct(shift)
+	require.NoError(t, err)
+	assert.Equal(t, "timestamp", schema.Fields["start"].Type)
+	assert.Equal(t, "date", schema.Fields["day"].Type)
+	assert.Equal(t, "duration", schema.Fields["length"].Type)
+	assert.Equal(t, "timestamp?", fieldTypeToString(schema.Fields["ended"]))
+	assert.Equal(t, "duration[]", fieldTypeToString(schema.Fields["breaks"]))
+
+	content, err := NewWriter().WriteStruct(shift)
+	require.NoError(t, err)
+	assert.Contains(t, content, "start:\n    2024-03-01T09:30:00.5+07:00\nday:\n    2024-03-01\nlength:\n    8h30m0s\nended: null\nbreaks[2]: 15m0s|1h0m0s\n")
+
+	parsed, err := NewParser().ParseMetaDat(content)
+	require.NoError(t, err)
+	assert.True(t, shift.Start.Equal(parsed["start"].(time.Time)))
+	assert.Equal(t, shift.Day, parsed["day"])
+	assert.Equal(t, shift.Length, parsed["length"])
+	assert.Equal(t, []interface{}{15 * time.Minute, time.Hour}, parsed["breaks"])
+	require.NoError(t, schema.ValidateData(parsed))
+
+	var decoded Shift
+	require.NoError(t, Unmarshal([]byte(content), &decoded))
+	assert.True(t, shift.Start.Equal(decoded.Start))
+	assert.Equal(t, "+07:00", decoded.Start.Format("-07:00"))
+	decoded.Start = shift.Start
+	assert.Equal(t, shift, decoded)
+
+	// Strings holding canonical text are accepted by the writer and by validation
+	writer := NewWriter()
+	writer.SetSchema(schema)
+	content, err = writer.WriteMetaDat(map[string]interface{}{"start": "2024-03-01T09:30:00Z", "length": "90m"})
+	require.NoError(t, err)
+	assert.Contains(t, content, "length:\n    1h30m0s\n")
+	assert.NoError(t, schema.ValidateData(map[string]interface{}{"day": "2024-03-01"}))
+	assert.EqualError(t, schema.ValidateData(map[string]interface{}{"day": time.Hour}), "field day: expected time, got time.Duration")
+
+	_, err = writer.WriteMetaDat(map[string]interface{}{"day": "01/03/2024"})
+	assert.EqualError(t, err, "error writing field day: invalid date value: 01/03/2024")
+
+	// Object fields and JSON conversion
+	jsonStr, err := ConvertMetaDatToJSON("meta\n    shift: {day:date|length:duration}\n    at: timestamp\ndata\n    shift: 2024-03-01|1h30m\n    at: 2024-03-01T09:30:00+07:00\n")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"shift": {"day": "2024-03-01", "length": "1h30m0s"}, "at": "2024-03-01T09:30:00+07:00"}`, jsonStr)
+}
+
+func TestParseTemporalErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		errMsg  string
+	}{
+		{
+			name:    "timestamp without offset",
+			content: "meta\n    at: timestamp\ndata\n    at: 2024-03-01T09:30:00\n",
+			errMsg:  "line 4, column 9: field at: invalid timestamp value: 2024-03-01T09:30:00",
+		},
+		{
+			name:    "invalid date",
+			content: "meta\n    days: date[]\ndata\n    days[2]: 2024-03-01|2024-02-30\n",
+			errMsg:  "line 4, column 25: field days[1]: invalid date value: 2024-02-30",
+		},
+		{
+			name:    "duration without unit",
+			content: "meta\n    timeout: duration\ndata\n    timeout: 30\n",
+			errMsg:  "line 4, column 14: field timeout: invalid duration value: 30",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewParser().ParseMetaDat(tt.content)
+			require.Error(t, err)
+			assert.Equal(t, tt.errMsg, err.Error())
+			var typeErr *TypeError
+			require.True(t, errors.As(err, &typeErr))
+		})
+	}
+}
+
+func TestBytesType(t *testing.T) {
+	type Attachment struct {
+		Name      string   `json:"name"`
+		Thumbnail []byte   `json:"thumbnail"`
+		Hash      [4]byte  `metadat:"hash,type=bytes(hex)"`
+		Chunks    [][]byte `json:"chunks"`
+		Empty     []byte   `json:"empty"`
+		Missing   []byte   `json:"missing,omitempty"`
+	}
+
+	attachment := Attachment{
+		Name:      "logo.png",
+		Thumbnail: []byte{0x89, 'P', 'N', 'G', 0xff, 0xfe},
+		Hash:      [4]byte{0xde, 0xad, 0xbe, 0xef},
+		Chunks:    [][]byte{[]byte("ab"), []byte("c")},
+		Empty:     []byte{},
+	}
+
+	schema, err := InferSchemaFromStruct(attachment)
+	require.NoError(t, err)
+	assert.Equal(t, FieldType{Type: "bytes", Name: "thumbnail"}, schema.Fields["thumbnail"])
+	assert.Equal(t, "bytes(hex)", fieldTypeToString(schema.Fields["hash"]))
+	assert.Equal(t, "bytes[]", fieldTypeToString(schema.Fields["chunks"]))
+
+	content, err := NewWriter().WriteStruct(attachment)
+	require.NoError(t, err)
+	assert.Contains(t, content, "    hash: bytes(hex)\n")
+	assert.Contains(t, content, "thumbnail:\n    iVBOR//+\nhash:\n    deadbeef\nchunks[2]: YWI=|Yw==\nempty:\n    \"\"\n")
+
+	parsed, err := NewParser().ParseMetaDat(content)
+	require.NoError(t, err)
+	assert.Equal(t, attachment.Thumbnail, parsed["thumbnail"])
+	assert.Equal(t, []byte{0xde, 0xad, 0xbe, 0xef}, parsed["hash"])
+	assert.Equal(t, []interface{}{[]byte("ab"), []byte("c")}, parsed["chunks"])
+	assert.Equal(t, []byte{}, parsed["empty"])
+	require.NoError(t, schema.ValidateData(parsed))
+
+	var decoded Attachment
+	require.NoError(t, Unmarshal([]byte(content), &decoded))
+	assert.Equal(t, attachment, decoded)
+
+	// A nil slice in a zero-value struct is written as empty bytes
+	type Blob struct {
+		Name string `json:"name"`
+		Data []byte `json:"data"`
+	}
+	content, err = NewWriter().WriteStruct(Blob{Name: "a"})
+	require.NoError(t, err)
+	assert.Contains(t, content, "data:\n    \"\"\n")
+	var blob Blob
+	require.NoError(t, Unmarshal([]byte(content), &blob))
+	assert.Equal(t, "a", blob.Name)
+	assert.Empty(t, blob.Data)
+
+	// Objects, validation and JSON conversion
+	content = "meta\n    file: {name:string|sig:bytes(hex)|data:bytes?}\ndata\n    file: a.txt|0a0b|null\n"
+	parsed, err = NewParser().ParseMetaDat(content)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "a.txt", "sig": []byte{0x0a, 0x0b}, "data": nil}, parsed["file"])
+
+	jsonStr, err := ConvertMetaDatToJSON(content)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"file": {"name": "a.txt", "sig": "0a0b", "data": null}}`, jsonStr)
+
+	assert.NoError(t, schema.ValidateData(map[string]interface{}{"thumbnail": "YWI="}))
+	assert.EqualError(t, schema.ValidateData(map[string]interface{}{"hash": "xyz"}), "field hash: invalid hex value: xyz")
+
+	_, err = NewParser().ParseMetaDat("meta\n    data: bytes\ndata\n    data: not*base64\n")
+	assert.EqualError(t, err, "line 4, column 11: field data: invalid base64 value: not*base64")
+
+	_, err = parseType("bytes(base32)")
+	assert.EqualError(t, err, "unknown bytes encoding: base32")
+
+	var short struct {
+		Hash [2]byte `metadat:"hash"`
+	}
+	err = Unmarshal([]byte("meta\n    hash: bytes(hex)\ndata\n    hash: deadbeef\n"), &short)
+	assert.EqualError(t, err, "cannot assign 4 bytes to Go type [2]uint8 for field hash")
+}
+
+type testPriority int
+
+func TestEnumTypes(t *testing.T) {
+	type OrderStatus string
+	type Order struct {
+		ID       int          `json:"id"`
+		Status   OrderStatus  `metadat:"status,type=enum(pending|paid|refunded)"`
+		Priority testPriority `metadat:"priority,type=enum(low|normal|high)"`
+		History  []string     `metadat:"history,type=enum(pending|paid|refunded)[]"`
+	}
+
+	order := Order{ID: 7, Status: "paid", Priority: 2, History: []string{"pending", "paid"}}
+	schema, err := InferSchemaFromStruct(order)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pending", "paid", "refunded"}, schema.Fields["status"].EnumValues)
+	assert.Contains(t, schema.ToString(), "    status: enum(pending|paid|refunded)\n    priority: enum(low|normal|high)\n    history: enum(pending|paid|refunded)[]\n")
+
+	content, err := NewWriter().WriteStruct(order)
+	require.NoError(t, err)
+	assert.Contains(t, content, "status:\n    paid\npriority:\n    high\nhistory[2]: pending|paid\n")
+
+	parsed, err := NewParser().ParseMetaDat(content)
+	require.NoError(t, err)
+	assert.Equal(t, "paid", parsed["status"])
+	assert.Equal(t, "high", parsed["priority"])
+	require.NoError(t, schema.ValidateData(parsed))
+
+	var decoded Order
+	require.NoError(t, Unmarshal([]byte(content), &decoded))
+	assert.Equal(t, order, decoded)
+
+	// Validation
+	assert.EqualError(t, schema.ValidateData(map[string]interface{}{"status": "payed"}),
+		"field status: invalid enum value: payed, expected one of pending|paid|refunded")
+	assert.EqualError(t, schema.ValidateData(map[string]interface{}{"priority": 3}),
+		"field priority: enum index 3 out of range for enum(low|normal|high)")
+
+	// Enums inside objects, with nullable values
+	content = "meta\n    items: {sku:string|state:enum(new|used)?|qty:int}[]\ndata\n    items[3]:\n        A1|new|2\n        B2|null|1\n        C3|broken|1\n"
+	_, err = NewParser().ParseMetaDat(content)
+	assert.EqualError(t, err, "line 7, column 12: field items[2].state: invalid enum value: broken, expected one of new|used")
+	var typeErr *TypeError
+	require.True(t, errors.As(err, &typeErr))
+	assert.Equal(t, "enum(new|used)?", typeErr.Type)
+
+	parsed, err = NewParser().ParseMetaDat(strings.Replace(content, "broken", "used", 1))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"sku": "A1", "state": "new", "qty": 2},
+		map[string]interface{}{"sku": "B2", "state": nil, "qty": 1},
+		map[string]interface{}{"sku": "C3", "state": "used", "qty": 1},
+	}, parsed["items"])
+
+	for _, typeStr := range []string{"enum()", "enum(a|a)", "enum(a b)", "enum(a|null)", "enum(x|{y})"} {
+		_, err := parseType(typeStr)
+		assert.Error(t, err, typeStr)
+	}
+}
+
+func TestIntegerWidths(t *testing.T) {
+	content := `meta
+    small: int8
+    byte: uint8
+    count: int32
+    id: uint64
+    offset: int64
+    deltas: int16[]
+data
+    small: -128
+    byte: 255
+    count: -2147483648
+    id: 18446744073709551615
+    offset: -9223372036854775808
+    deltas[3]: 1|-2|+3
+`
+	data, err := NewParser().ParseMetaDat(content)
+	require.NoError(t, err)
+	assert.Equal(t, int8(-128), data["small"])
+	assert.Equal(t, uint8(255), data["byte"])
+	assert.Equal(t, int32(-2147483648), data["count"])
+	assert.Equal(t, uint64(math.MaxUint64), data["id"])
+	assert.Equal(t, int64(math.MinInt64), data["offset"])
+	assert.Equal(t, []interface{}{int16(1), int16(-2), int16(3)}, data["deltas"])
+
+	for _, tc := range []struct{ from, to, msg string }{
+		{"count: -2147483648", "count: 5000000000", "line 11, column 12: field count: value 5000000000 out of range for int32"},
+		{"byte: 255", "byte: -1", "line 10, column 11: field byte: value -1 out of range for uint8"},
+		{"id: 18446744073709551615", "id: 18446744073709551616", "line 12, column 9: field id: value 18446744073709551616 out of range for uint64"},
+		{"1|-2|+3", "1|-2|40000", "line 14, column 21: field deltas[2]: value 40000 out of range for int16"},
+		{"small: -128", "small: 1.5", "line 9, column 12: field small: invalid integer value: 1.5"},
+		{"small: -128", "small: +-1", "line 9, column 12: field small: invalid integer value: +-1"},
+	} {
+		_, err := NewParser().ParseMetaDat(strings.Replace(content, tc.from, tc.to, 1))
+		assert.EqualError(t, err, tc.msg)
+		var typeErr *TypeError
+		assert.True(t, errors.As(err, &typeErr), tc.to)
+	}
+
+	// Validation checks the declared range; JSON numbers arrive as float64
+	schema, err := parseSchema("small: int8\nid: uint64\nratio: float32")
+	require.NoError(t, err)
+	require.NoError(t, schema.ValidateData(map[string]interface{}{"small": float64(-5), "id": uint64(math.MaxUint64), "ratio": int8(2)}))
+	assert.EqualError(t, schema.ValidateData(map[string]interface{}{"small": 300}),
+		"field small: value 300 out of range for int8")
+	assert.EqualError(t, schema.ValidateData(map[string]interface{}{"id": -1}),
+		"field id: value -1 out of range for uint64")
+	assert.EqualError(t, schema.ValidateData(map[string]interface{}{"small": 1.5}),
+		"field small: value 1.5 is not an integer")
+
+	// Struct fields keep their declared widths through a round trip
+	type Counters struct {
+		Small  int8    `json:"small"`
+		Port   uint16  `json:"port"`
+		ID     uint64  `json:"id"`
+		Offset int64   `json:"offset"`
+		Level  int     `metadat:"level,type=uint8"`
+		Ratios []int32 `json:"ratios"`
+	}
+	counters := Counters{Small: -8, Port: 8080, ID: math.MaxUint64, Offset: math.MinInt64, Level: 200, Ratios: []int32{1, -1}}
+	inferred, err := InferSchemaFromStruct(counters)
+	require.NoError(t, err)
+	assert.Contains(t, inferred.ToString(), "    small: int8\n    port: uint16\n    id: uint64\n    offset: int64\n    level: uint8\n    ratios: int32[]\n")
+
+	written, err := NewWriter().WriteStruct(counters)
+	require.NoError(t, err)
+	assert.Contains(t, written, "id:\n    18446744073709551615\n")
+
+	var decoded Counters
+	require.NoError(t, Unmarshal([]byte(written), &decoded))
+	assert.Equal(t, counters, decoded)
+
+	// Values that do not fit the declared type or the Go type are rejected
+	counters.Level = 300
+	_, err = NewWriter().WriteStruct(counters)
+	assert.EqualError(t, err, "error writing field level: value 300 out of range for uint8")
+
+	var narrow struct {
+		ID int64 `json:"id"`
+	}
+	err = Unmarshal([]byte(written), &narrow)
+	assert.EqualError(t, err, "value 18446744073709551615 overflows Go type int64 for field id")
+}
+
+type testCents int64
+
+func (c *testCents) UnmarshalText(text []byte) error {
+	d, err := ParseDecimal(string(text))
+	if err != nil {
+		return err
+	}
+	cents, _ := new(big.Rat).Mul(d.Rat(), big.NewRat(100, 1)).Float64()
+	*c = testCents(cents)
+	return nil
+}
+
+func TestDecimalType(t *testing.T) {
+	content := `meta
+    price: decimal(10,2)
+    rate: decimal
+    discounts: decimal(3,2)[]
+data
+    price: 0012.50
+    rate: -0.000001
+    discounts[2]: 0.10|-0.00
+`
+	data, err := NewParser().ParseMetaDat(content)
+	require.NoError(t, err)
+	price := data["price"].(Decimal)
+	assert.Equal(t, "12.50", price.String())
+	assert.Equal(t, 4, price.Precision())
+	assert.Equal(t, 2, price.Scale())
+	assert.Equal(t, big.NewRat(25, 2), price.Rat())
+	assert.Equal(t, "-0.000001", data["rate"].(Decimal).String())
+	assert.Equal(t, []interface{}{Decimal{text: "0.10"}, Decimal{text: "0.00"}}, data["discounts"])
+
+	parser := NewParser()
+	require.NoError(t, parser.ParseSchema(content[:strings.Index(content, "data")]))
+	schema := parser.Schema()
+	assert.Equal(t, FieldType{Type: "decimal", Precision: 10, Scale: 2}, schema.Fields["price"])
+	assert.Contains(t, schema.ToString(), "    price: decimal(10,2)\n    rate: decimal\n    discounts: decimal(3,2)[]\n")
+
+	for _, tc := range []struct{ from, to, msg string }{
+		{"0012.50", "12.505", "line 6, column 12: field price: value 12.505 has more than 2 decimal places for decimal(10,2)"},
+		{"0012.50", "123456789", "line 6, column 12: field price: value 123456789 out of range for decimal(10,2)"},
+		{"-0.000001", "1e-6", "line 7, column 11: field rate: invalid decimal value: 1e-6"},
+		{"0.10|", "10|", "line 8, column 19: field discounts[0]: value 10 out of range for decimal(3,2)"},
+	} {
+		_, err := NewParser().ParseMetaDat(strings.Replace(content, tc.from, tc.to, 1))
+		assert.EqualError(t, err, tc.msg)
+	}
+
+	for _, typeStr := range []string{"decimal(0)", "decimal(2,3)", "decimal(x,1)", "decimal(4,-1)"} {
+		_, err := parseType(typeStr)
+		assert.Error(t, err, typeStr)
+	}
+
+	// Validation enforces precision and scale for any representation of the value
+	assert.NoError(t, schema.ValidateData(map[string]interface{}{"price": "99999999.99", "rate": 1.25, "discounts": []interface{}{0, Decimal{}}}))
+	assert.EqualError(t, schema.ValidateData(map[string]interface{}{"price": 0.125}),
+		"field price: value 0.125 has more than 2 decimal places for decimal(10,2)")
+	assert.EqualError(t, schema.ValidateData(map[string]interface{}{"price": true}),
+		"field price: expected decimal, got bool")
+
+	// Struct fields: Decimal, text unmarshalers and strings
+	type Invoice struct {
+		Total    Decimal   `metadat:"total,type=decimal(12,2)"`
+		Tax      Decimal   `json:"tax"`
+		Cents    testCents `metadat:"cents,type=decimal(6,2)"`
+		Shipping string    `metadat:"shipping,type=decimal(6,2)"`
+	}
+	total, err := ParseDecimal("1049.90")
+	require.NoError(t, err)
+	inferred, err := InferSchemaFromStruct(Invoice{})
+	require.NoError(t, err)
+	assert.Equal(t, "decimal", inferred.Fields["tax"].Type)
+
+	content = "meta\n    total: decimal(12,2)\n    tax: decimal\n    cents: decimal(6,2)\n    shipping: decimal(6,2)\ndata\n    total: 1049.90\n    tax: 0.1\n    cents: 4.99\n    shipping: 7.50\n"
+	var invoice Invoice
+	require.NoError(t, Unmarshal([]byte(content), &invoice))
+	assert.Equal(t, Invoice{Total: total, Tax: Decimal{text: "0.1"}, Cents: 499, Shipping: "7.50"}, invoice)
+
+	written, err := NewWriter().WriteStruct(Invoice{Total: total, Tax: Decimal{text: "0.1"}, Shipping: "7.50"})
+	require.NoError(t, err)
+	assert.Contains(t, written, "total:\n    1049.90\ntax:\n    0.1\n")
+
+	// JSON conversion keeps every digit
+	jsonStr, err := ConvertMetaDatToJSON(content)
+	require.NoError(t, err)
+	assert.Contains(t, jsonStr, `"total": 1049.90`)
+}
+
+func TestMapType(t *testing.T) {
+	content := `meta
+    labels: map<string,string>
+    counts: map<string,int?>
+    regions: map<string,{name:string|tags:string[]}>
+    flags: map<string,bool>[]
+data
+    labels:
+        env: prod
+        "team:name": "core platform"
+    counts:
+        TH: 12
+        "": null
+    regions:
+        eu:
+            Europe|[de|fr]
+        us:
+            Americas|[]
+    flags[2]:
+        {beta:true|dark:false}
+        {}
+`
+	data, err := NewParser().ParseMetaDat(content)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"env": "prod", "team:name": "core platform"}, data["labels"])
+	assert.Equal(t, map[string]interface{}{"TH": 12, "": nil}, data["counts"])
+	assert.Equal(t, map[string]interface{}{
+		"eu": map[string]interface{}{"name": "Europe", "tags": []interface{}{"de", "fr"}},
+		"us": map[string]interface{}{"name": "Americas", "tags": []interface{}{}},
+	}, data["regions"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"beta": true, "dark": false},
+		map[string]interface{}{},
+	}, data["flags"])
+
+	parser := NewParser()
+	require.NoError(t, parser.ParseSchema(content[:strings.Index(content, "data")]))
+	schema := parser.Schema()
+	assert.Equal(t, "map<string,int?>", fieldTypeToString(schema.Fields["counts"]))
+	assert.Contains(t, schema.ToString(), "    regions: map<string,{name:string|tags:string[]}>\n    flags: map<string,bool>[]\n")
+
+	// The writer sorts keys and quotes those that are not plain names
+	w := NewWriter()
+	w.SetSchema(schema)
+	written, err := w.WriteMetaDat(data)
+	require.NoError(t, err)
+	reparsed, err := NewParser().ParseMetaDat(written)
+	require.NoError(t, err)
+	assert.Equal(t, data, reparsed)
+	assert.Contains(t, written, "labels:\n    env: prod\n    \"team:name\": core platform\ncounts:\n    \"\": null\n    TH: 12\n")
+	assert.Contains(t, written, "flags[2]:\n    {beta:true|dark:false}\n    {}")
+
+	// Errors name the map key
+	for _, tc := range []struct{ from, to, msg string }{
+		{"TH: 12", "TH: many", `line 11, column 13: field counts["TH"]: invalid integer value: many`},
+		{"\"\": null", "TH: 1", `line 12, column 9: field counts["TH"]: duplicate map key`},
+		{"{beta:true|dark:false}", "{beta:true|beta:false}", `line 19, column 20: field flags[0]["beta"]: duplicate map key`},
+		{"{beta:true|dark:false}", "{beta}", `line 19, column 10: field flags[0]: invalid map entry: beta`},
+	} {
+		_, err := NewParser().ParseMetaDat(strings.Replace(content, tc.from, tc.to, 1))
+		assert.EqualError(t, err, tc.msg)
+	}
+
+	_, err = parseType("map<int,string>")
+	assert.EqualError(t, err, "unsupported map key type: int")
+
+	// Validation checks every value
+	assert.EqualError(t, schema.ValidateData(map[string]interface{}{"counts": map[string]interface{}{"a": 1, "b": "x"}}),
+		`field counts["b"]: expected integer, got string`)
+
+	// Go map fields with a declared value type are inferred as maps and decoded into Go maps
+	type Inventory struct {
+		Stock  map[string]int64            `json:"stock"`
+		Shelf  map[string][]string         `json:"shelf"`
+		Prices map[string]map[string]int32 `json:"prices"`
+	}
+	inventory := Inventory{
+		Stock:  map[string]int64{"apple": 3, "pear": 0},
+		Shelf:  map[string][]string{"a1": {"apple"}},
+		Prices: map[string]map[string]int32{"apple": {"EUR": 120}},
+	}
+	inferred, err := InferSchemaFromStruct(inventory)
+	require.NoError(t, err)
+	assert.Contains(t, inferred.ToString(), "    stock: map<string,int64>\n    shelf: map<string,string[]>\n    prices: map<string,map<string,int32>>\n")
+
+	written, err = NewWriter().WriteStruct(inventory)
+	require.NoError(t, err)
+	assert.Contains(t, written, "stock:\n    apple: 3\n    pear: 0\nshelf:\n    a1[1]: apple\nprices:\n    apple:\n        EUR: 120\n")
+
+	var decoded Inventory
+	require.NoError(t, Unmarshal([]byte(written), &decoded))
+	assert.Equal(t, inventory, decoded)
+
+	var wrong struct {
+		Stock map[string]bool `json:"stock"`
+	}
+	err = Unmarshal([]byte(written), &wrong)
+	assert.EqualError(t, err, `cannot assign schema type int64 to Go type bool for field stock["apple"]`)
+}
+
+func TestUnionType(t *testing.T) {
+	eventType := "union(kind){click:{x:int|y:int}|purchase:{sku!:string|amount:decimal(10,2)}|signup:{}}"
+	content := "meta\n    events: " + eventType + "[]\n    last: " + eventType + "\n    first: " + eventType + "?\n" + `data
+    events[3]:
+        click|10|20
+        purchase|A1|9.99
+        signup
+    last:
+        kind: purchase
+        sku: B2
+    first: click|1|
+`
+	data, err := NewParser().ParseMetaDat(content)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"kind": "click", "x": 10, "y": 20},
+		map[string]interface{}{"kind": "purchase", "sku": "A1", "amount": Decimal{text: "9.99"}},
+		map[string]interface{}{"kind": "signup"},
+	}, data["events"])
+	assert.Equal(t, map[string]interface{}{"kind": "purchase", "sku": "B2"}, data["last"])
+	assert.Equal(t, map[string]interface{}{"kind": "click", "x": 1}, data["first"])
+
+	parser := NewParser()
+	require.NoError(t, parser.ParseSchema(content[:strings.Index(content, "data")]))
+	schema := parser.Schema()
+	events := schema.Fields["events"].ElementType
+	assert.Equal(t, "kind", events.Discriminator)
+	assert.Equal(t, []string{"click", "purchase", "signup"}, events.VariantOrder)
+	assert.Equal(t, eventType+"[]", fieldTypeToString(schema.Fields["events"]))
+
+	// Each element is written with the layout of its variant
+	w := NewWriter()
+	w.SetSchema(schema)
+	written, err := w.WriteMetaDat(data)
+	require.NoError(t, err)
+	assert.Contains(t, written, "events[3]:\n    click|10|20\n    purchase|A1|9.99\n    signup\nlast:\n    purchase|B2|\n")
+	reparsed, err := NewParser().ParseMetaDat(written)
+	require.NoError(t, err)
+	assert.Equal(t, data, reparsed)
+
+	for _, tc := range []struct{ from, to, msg string }{
+		{"click|10|20", "tap|10|20", "line 7, column 9: field events[0].kind: unknown variant: tap, expected one of click|purchase|signup"},
+		{"purchase|A1|9.99", "purchase|A1|9.999", "line 8, column 21: field events[1].amount: value 9.999 has more than 2 decimal places for decimal(10,2)"},
+		{"        signup\n", "        signup|x\n", "line 9, column 16: field events[2]: too many values: expected 1, found 2"},
+		{"kind: purchase", "kind: refund", "line 11, column 9: field last.kind: unknown variant: refund, expected one of click|purchase|signup"},
+		{"        kind: purchase\n", "", "line 10: field last.kind: missing required field"},
+		{"sku: B2", "x: 1", "line 12, column 9: field last.x: unknown field"},
+	} {
+		_, err := NewParser().ParseMetaDat(strings.Replace(content, tc.from, tc.to, 1))
+		assert.EqualError(t, err, tc.msg)
+	}
+
+	// Validation and writing check each value against its own variant
+	invalid := map[string]interface{}{"events": []interface{}{
+		map[string]interface{}{"kind": "click", "x": 1, "sku": "A1"},
+	}}
+	assert.EqualError(t, schema.ValidateData(invalid),
+		"field events[0]: field sku is not part of variant click")
+	assert.EqualError(t, schema.ValidateData(map[string]interface{}{"last": map[string]interface{}{"kind": "purchase"}}),
+		"field last.sku: missing required field")
+	assert.EqualError(t, schema.ValidateData(map[string]interface{}{"last": map[string]interface{}{"x": 1}}),
+		"field last: missing discriminator field: kind")
+	_, err = w.WriteMetaDat(invalid)
+	assert.EqualError(t, err, "error writing field events: field sku is not part of variant click")
+
+	for _, typeStr := range []string{
+		"union(kind){}",
+		"union(kind){a:int}",
+		"union(kind){a:{kind:string}}",
+		"union(kind){a:{x:int}|a:{y:int}}",
+		"union(){a:{x:int}}",
+	} {
+		_, err := parseType(typeStr)
+		assert.Error(t, err, typeStr)
+	}
+
+	// Variants decode into a struct holding the fields of every variant
+	type Event struct {
+		Kind   string  `json:"kind"`
+		X      int     `json:"x"`
+		SKU    string  `json:"sku"`
+		Amount Decimal `json:"amount"`
+	}
+	var decoded struct {
+		Events []Event `json:"events"`
+	}
+	require.NoError(t, Unmarshal([]byte(content), &decoded))
+	assert.Equal(t, []Event{{Kind: "click", X: 10}, {Kind: "purchase", SKU: "A1", Amount: Decimal{text: "9.99"}}, {Kind: "signup"}}, decoded.Events)
+
+	jsonStr, err := ConvertMetaDatToJSON(content)
+	require.NoError(t, err)
+	assert.Contains(t, jsonStr, `"amount": 9.99`)
+}
+
+func TestNamedTypes(t *testing.T) {
+	content := `meta
+    type Address = {street:string|city:string}
+    type Tree = {value:int|children:Tree[]}
+    type Node = {name:string|next:Node?}
+    type Home = Address
+    home: Home
+    offices: Address[]
+    tree: Tree
+    list: Node
+data
+    home: 1 Main St|Springfield
+    offices[2]:
+        2 High St|Shelbyville
+        3 Low Rd|Ogdenville
+    tree: 1|[{2|[]}|{3|[{4|[]}]}]
+    list: a|{b|}
+`
+	parser := NewParser()
+	data, err := parser.ParseMetaDat(content)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"street": "1 Main St", "city": "Springfield"}, data["home"])
+	assert.Equal(t, map[string]interface{}{"street": "3 Low Rd", "city": "Ogdenville"}, data["offices"].([]interface{})[1])
+	assert.Equal(t, map[string]interface{}{"value": 1, "children": []interface{}{
+		map[string]interface{}{"value": 2, "children": []interface{}{}},
+		map[string]interface{}{"value": 3, "children": []interface{}{
+			map[string]interface{}{"value": 4, "children": []interface{}{}},
+		}},
+	}}, data["tree"])
+	assert.Equal(t, map[string]interface{}{"name": "a", "next": map[string]interface{}{"name": "b"}}, data["list"])
+
+	// References resolve to their definitions and keep the name they were written with
+	schema := parser.Schema()
+	assert.Equal(t, []string{"Address", "Tree", "Node", "Home"}, schema.TypeOrder)
+	assert.Equal(t, "Home", schema.Fields["home"].TypeName)
+	assert.Equal(t, "object", schema.Fields["home"].Type)
+	assert.Equal(t, "Address", schema.Fields["offices"].ElementType.TypeName)
+	children := schema.Fields["tree"].ObjectFields["children"]
+	assert.Equal(t, "Tree", children.ElementType.TypeName)
+	assert.Equal(t, []string{"value", "children"}, children.ElementType.ObjectOrder)
+	assert.True(t, schema.Fields["list"].ObjectFields["next"].Nullable)
+
+	assert.Equal(t, `    type Address = {street:string|city:string}
+    type Tree = {value:int|children:Tree[]}
+    type Node = {name:string|next:Node?}
+    type Home = Address
+    home: Home
+    offices: Address[]
+    tree: Tree
+    list: Node
+`, schema.ToString())
+
+	w := NewWriter()
+	w.SetSchema(schema)
+	written, err := w.WriteMetaDat(data)
+	require.NoError(t, err)
+	assert.Contains(t, written, "tree:\n    1|[{2|[]}|{3|[{4|[]}]}]\n")
+	reparsed, err := NewParser().ParseMetaDat(written)
+	require.NoError(t, err)
+	assert.Equal(t, data, reparsed)
+
+	assert.EqualError(t, schema.ValidateData(map[string]interface{}{"tree": map[string]interface{}{
+		"value": 1, "children": []interface{}{map[string]interface{}{"value": "x"}},
+	}}), "field tree.children[0].value: expected integer, got string")
+
+	type TreeNode struct {
+		Value    int        `json:"value"`
+		Children []TreeNode `json:"children"`
+	}
+	var tree TreeNode
+	require.NoError(t, Unmarshal([]byte(content), &struct {
+		Tree *TreeNode `json:"tree"`
+	}{&tree}))
+	assert.Equal(t, 4, tree.Children[1].Children[0].Value)
+
+	// Union variants and array documents may be named types as well
+	require.NoError(t, parser.ParseSchema("meta\n    type Click = {x:int|y:int}\n    type Event = union(kind){click:Click|signup:{}}\n    []: Event\n"))
+	assert.Equal(t, "    type Click = {x:int|y:int}\n    type Event = union(kind){click:Click|signup:{}}\n    []: Event\n", parser.Schema().ToString())
+	events, err := parser.ParseArray("meta\n    type Click = {x:int|y:int}\n    type Event = union(kind){click:Click|signup:{}}\n    []: Event\ndata\n[2]:\n    click|1|2\n    signup\n")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"kind": "click", "x": 1, "y": 2}, events[0])
+
+	for _, tc := range []struct{ meta, msg string }{
+		{"    type A = B\n    type B = A\n", "line 2, column 5: type A is defined in terms of itself"},
+		{"    type A = {x:Missing}\n", "line 2, column 14: error parsing type A: unknown type: Missing"},
+		{"    type A = {x:int}\n    a: B\n", "line 3, column 8: field a: unknown type: B"},
+		{"    type int = {x:int}\n", "line 2, column 5: type name int is a built-in type"},
+		{"    type 1A = {x:int}\n", `line 2, column 5: invalid type name: "1A"`},
+		{"    type A = {x:int}\n    type A = {y:int}\n", "line 3, column 5: duplicate type: A"},
+		{"    type A = {kind:string}\n    e: union(kind){a:A}\n", "line 3, column 5: field e: union variant a redeclares discriminator field kind"},
+		{"    type A = int\n    e: union(kind){a:A}\n", "line 3, column 5: field e: union variant a must be an object type"},
+	} {
+		assert.EqualError(t, NewParser().ParseSchema("meta\n"+tc.meta), tc.msg)
+	}
+}
+
+func TestSchemaImports(t *testing.T) {
+	files := map[string]string{
+		"common/address.metadat": "meta\n    type Address = {street:string|city:string}\n",
+		"common/person.metadat":  "meta\n    import \"address.metadat\"\n    type Person = {name:string|home:Address}\n",
+	}
+	content := `meta
+    import "common/person.metadat"
+    import "common/address.metadat"
+    owner: Person
+    offices: Address[]
+data
+    owner: Ann|{1 Main St|Springfield}
+    offices[1]:
+        2 High St|Shelbyville
+`
+	parser := NewParser()
+	parser.SetLoader(MapLoader(files))
+	data, err := parser.ParseMetaDat(content)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name": "Ann",
+		"home": map[string]interface{}{"street": "1 Main St", "city": "Springfield"},
+	}, data["owner"])
+
+	// Imports are written back as directives rather than copied in
+	schema := parser.Schema()
+	assert.Equal(t, []string{"common/person.metadat", "common/address.metadat"}, schema.Imports)
+	assert.Nil(t, schema.Types)
+	assert.Equal(t, "    import \"common/person.metadat\"\n    import \"common/address.metadat\"\n    owner: Person\n    offices: Address[]\n", schema.ToString())
+
+	// Types imported by an imported file are not passed on
+	err = parser.ParseSchema("meta\n    import \"common/person.metadat\"\n    home: Address\n")
+	assert.EqualError(t, err, "line 3, column 11: field home: unknown type: Address")
+
+	fsys := fstest.MapFS{"shared/address.metadat": {Data: []byte(files["common/address.metadat"])}}
+	parser.SetLoader(FSLoader(fsys))
+	require.NoError(t, parser.ParseSchema("meta\n    import \"shared/address.metadat\"\n    home: Address\n"))
+	assert.Equal(t, "Address", parser.Schema().Fields["home"].TypeName)
+
+	// Without a loader, documents parsed from strings cannot import files
+	secret := t.TempDir() + "/secret.txt"
+	require.NoError(t, os.WriteFile(secret, []byte("hunter2 token"), 0644))
+	document := "meta\n    import " + strconv.Quote(secret) + "\n    secret: string\ndata\n    secret: x\n"
+	_, err = NewParser().ParseMetaDat(document)
+	assert.EqualError(t, err, fmt.Sprintf("line 2, column 12: import %q: imports are not enabled, set a Loader to read %s", secret, secret))
+	decoder := NewDecoder(strings.NewReader(document))
+	assert.False(t, decoder.Next())
+	assert.NotContains(t, decoder.Err().Error(), "hunter2")
+
+	// Schema files read by ParseFromFiles import from the file system, relative to the file
+	tmpDir := t.TempDir()
+	require.NoError(t, os.Mkdir(tmpDir+"/common", 0755))
+	require.NoError(t, os.WriteFile(tmpDir+"/common/address.metadat", []byte(files["common/address.metadat"]), 0644))
+	require.NoError(t, os.WriteFile(tmpDir+"/schema.metadat", []byte("meta\n    import \"common/address.metadat\"\n    home: Address\n"), 0644))
+	require.NoError(t, os.WriteFile(tmpDir+"/data.metadat", []byte("home: 3 Low Rd|Ogdenville\n"), 0644))
+	fromFiles, err := NewParser().ParseFromFiles(tmpDir+"/schema.metadat", tmpDir+"/data.metadat")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"street": "3 Low Rd", "city": "Ogdenville"}, fromFiles["home"])
+
+	errorFiles := map[string]string{
+		"a.metadat":   "meta\n    import \"b.metadat\"\n",
+		"b.metadat":   "meta\n    import \"a.metadat\"\n",
+		"bad.metadat": "meta\n    type Bad = {x:Missing}\n",
+		"dup.metadat": "meta\n    type Address = {line:string}\n",
+	}
+	for name, content := range files {
+		errorFiles[name] = content
+	}
+	for _, tc := range []struct{ meta, msg string }{
+		{`import "a.metadat"`, `line 2, column 12: import "a.metadat": line 2, column 12: import "b.metadat": line 2, column 12: import "a.metadat": import cycle: a.metadat -> b.metadat -> a.metadat`},
+		{`import "bad.metadat"`, `line 2, column 12: import "bad.metadat": line 2, column 16: error parsing type Bad: unknown type: Missing`},
+		{`import "missing.metadat"`, `line 2, column 12: import "missing.metadat": schema file not found: missing.metadat`},
+		{`import missing.metadat`, "line 2, column 12: invalid import: missing.metadat"},
+		{"import \"common/address.metadat\"\n    import \"dup.metadat\"", `line 3, column 12: import "dup.metadat": duplicate type: Address, already imported from common/address.metadat`},
+		{"import \"common/address.metadat\"\n    type Address = {line:string}", "line 3, column 5: duplicate type: Address, already imported from common/address.metadat"},
+	} {
+		parser := NewParser()
+		parser.SetLoader(MapLoader(errorFiles))
+		assert.EqualError(t, parser.ParseSchema("meta\n    "+tc.meta+"\n"), tc.msg)
+	}
+}
+
 // Benchmark tests
 func BenchmarkWriteStruct(b *testing.B) {
 	user := User{
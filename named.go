@@ -0,0 +1,112 @@
+package metadat
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// typeScope holds the named types declared in a meta section with "type Name = type".
+// While the meta section is parsed, a reference to a named type is a FieldType with only
+// TypeName set; resolve then replaces it with a copy of the definition. Copies share the
+// maps and pointers of their definition, so recursive types form cycles instead of
+// expanding without end.
+type typeScope map[string]*FieldType
+
+// parseTypeDeclaration splits a "type Name = definition" line of the meta section. It
+// reports false for lines that are not type declarations.
+func parseTypeDeclaration(text string) (name string, typeStr string, ok bool) {
+	rest, found := strings.CutPrefix(text, "type ")
+	if !found {
+		return "", "", false
+	}
+	name, typeStr, found = strings.Cut(rest, "=")
+	if !found {
+		return "", "", false
+	}
+	return strings.TrimSpace(name), strings.TrimSpace(typeStr), true
+}
+
+// checkTypeName reports a name that cannot be declared as a named type
+func checkTypeName(name string) error {
+	for i, r := range name {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return fmt.Errorf("invalid type name: %q", name)
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("invalid type name: %q", name)
+	}
+	if _, err := parseType(name); err == nil {
+		return fmt.Errorf("type name %s is a built-in type", name)
+	}
+	return nil
+}
+
+// reference returns the type a reference to a named type stands for: a copy of the
+// definition that keeps the name, field name and markers of the reference
+func (scope typeScope) reference(ref FieldType) FieldType {
+	resolved := *scope[ref.TypeName]
+	resolved.TypeName = ref.TypeName
+	resolved.Name = ref.Name
+	resolved.Required = ref.Required
+	resolved.Nullable = resolved.Nullable || ref.Nullable
+	return resolved
+}
+
+// resolveAlias resolves a named type defined as another named type, such as
+// "type Home = Address", reporting aliases that lead back to themselves
+func (scope typeScope) resolveAlias(name string, seen map[string]bool) error {
+	def := scope[name]
+	if def.Type != "" {
+		return nil
+	}
+	if seen[name] {
+		return fmt.Errorf("type %s is defined in terms of itself", name)
+	}
+	seen[name] = true
+	if err := scope.resolveAlias(def.TypeName, seen); err != nil {
+		return err
+	}
+	*def = scope.reference(*def)
+	return nil
+}
+
+// resolve replaces the references to named types within fieldType, in place. References
+// are not followed, so every type is walked only once and recursion ends.
+func (scope typeScope) resolve(fieldType *FieldType) error {
+	if fieldType.TypeName != "" {
+		if fieldType.Type == "" {
+			*fieldType = scope.reference(*fieldType)
+		}
+		return nil
+	}
+
+	switch fieldType.Type {
+	case "array", "map":
+		if fieldType.ElementType != nil {
+			return scope.resolve(fieldType.ElementType)
+		}
+
+	case "object":
+		for name, field := range fieldType.ObjectFields {
+			if err := scope.resolve(&field); err != nil {
+				return err
+			}
+			fieldType.ObjectFields[name] = field
+		}
+
+	case "union":
+		for _, name := range fieldType.VariantOrder {
+			variant := fieldType.Variants[name]
+			if err := scope.resolve(&variant); err != nil {
+				return err
+			}
+			if err := checkVariant(name, variant, fieldType.Discriminator); err != nil {
+				return err
+			}
+			fieldType.Variants[name] = variant
+		}
+	}
+	return nil
+}
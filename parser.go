@@ -1,288 +1,718 @@
 package metadat
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
 )
 
-// parseValue parses a value according to its type from the data section
-func parseValue(fieldType FieldType, valueStr string, lines []string, currentIndex int) (interface{}, int, error) {
+// line is a single line of a MetaDat document
+type line struct {
+	text string // line content without the line terminator
+	num  int    // 1-based line number
+}
+
+// indent returns the width of the line's leading whitespace
+func (l line) indent() int {
+	return len(l.text) - len(strings.TrimLeft(l.text, " \t"))
+}
+
+// blank reports whether the line holds only whitespace
+func (l line) blank() bool {
+	return strings.TrimSpace(l.text) == ""
+}
+
+// lineReader reads a document one line at a time with a single line of lookahead
+type lineReader struct {
+	r      *bufio.Reader
+	num    int
+	peeked *line
+	eof    bool
+	err    error
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{r: bufio.NewReader(r)}
+}
+
+// peek returns the next line without consuming it
+func (lr *lineReader) peek() (line, bool) {
+	if lr.peeked != nil {
+		return *lr.peeked, true
+	}
+	if lr.eof || lr.err != nil {
+		return line{}, false
+	}
+
+	text, err := lr.r.ReadString('\n')
+	if err != nil {
+		if err != io.EOF {
+			lr.err = err
+			return line{}, false
+		}
+		lr.eof = true
+		if text == "" {
+			return line{}, false
+		}
+	}
+
+	lr.num++
+	text = strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r")
+	lr.peeked = &line{text: text, num: lr.num}
+	return *lr.peeked, true
+}
+
+// next consumes and returns the next line
+func (lr *lineReader) next() (line, bool) {
+	l, ok := lr.peek()
+	lr.peeked = nil
+	return l, ok
+}
+
+// readBlock consumes the lines nested below a line with the given indentation:
+// every following line that is blank or indented deeper
+func (lr *lineReader) readBlock(indent int) []line {
+	var block []line
+	for {
+		l, ok := lr.peek()
+		if !ok || (!l.blank() && l.indent() <= indent) {
+			return block
+		}
+		lr.next()
+		block = append(block, l)
+	}
+}
+
+// dataBlock is a header line together with the lines nested below it
+type dataBlock struct {
+	header line
+	body   []line
+}
+
+// splitBlocks groups lines into blocks, starting a new block at every line that is
+// indented no deeper than the first non-blank line
+func splitBlocks(lines []line) []dataBlock {
+	var blocks []dataBlock
+	indent := -1
+
+	for _, l := range lines {
+		if l.blank() {
+			if len(blocks) > 0 {
+				blocks[len(blocks)-1].body = append(blocks[len(blocks)-1].body, l)
+			}
+			continue
+		}
+		if indent == -1 {
+			indent = l.indent()
+		}
+		if l.indent() <= indent {
+			blocks = append(blocks, dataBlock{header: l})
+			continue
+		}
+		blocks[len(blocks)-1].body = append(blocks[len(blocks)-1].body, l)
+	}
+
+	return blocks
+}
+
+// nonBlank returns the lines that carry content
+func nonBlank(lines []line) []line {
+	result := make([]line, 0, len(lines))
+	for _, l := range lines {
+		if !l.blank() {
+			result = append(result, l)
+		}
+	}
+	return result
+}
+
+// parseFieldHeader splits a "name:", "name: value" or "name[3]: value" line.
+// The returned size is -1 when no array size is declared.
+func parseFieldHeader(l line) (name string, size int, value string, err error) {
+	text := strings.TrimSpace(l.text)
+	column := l.indent() + 1
+	colonIndex := strings.Index(text, ":")
+	if colonIndex == -1 {
+		return "", -1, "", &SyntaxError{Position: Position{Line: l.num, Column: column}, Text: text, Msg: "invalid data format: " + text}
+	}
+
+	name = strings.TrimSpace(text[:colonIndex])
+	value = strings.TrimSpace(text[colonIndex+1:])
+	size = -1
+
+	// Handle array notation like "arrayName[3]:"
+	if bracketIndex := strings.Index(name, "["); bracketIndex != -1 {
+		if !strings.HasSuffix(name, "]") {
+			return "", -1, "", &SyntaxError{Position: Position{Line: l.num, Column: column}, Text: name, Msg: "invalid array size: " + name}
+		}
+		sizeStr := name[bracketIndex+1 : len(name)-1]
+		size, err = strconv.Atoi(sizeStr)
+		if err != nil || size < 0 {
+			return "", -1, "", &SyntaxError{Position: Position{Line: l.num, Column: column + bracketIndex + 1}, Text: sizeStr, Msg: "invalid array size: " + sizeStr}
+		}
+		name = strings.TrimSpace(name[:bracketIndex])
+	}
+
+	return name, size, value, nil
+}
+
+// valueColumn returns the column of value, which ends the trimmed text of l
+func valueColumn(l line, value string) int {
+	return len(strings.TrimRight(l.text, " \t")) - len(value) + 1
+}
+
+// unexpectedContent reports a line that does not belong where it appears
+func unexpectedContent(l line) error {
+	text := strings.TrimSpace(l.text)
+	return &SyntaxError{Position: Position{Line: l.num, Column: l.indent() + 1}, Text: text, Msg: "unexpected content: " + text}
+}
+
+// parseFieldValue parses a non-array value whose text starts after the colon of the header
+// line and may continue in the nested body lines
+func parseFieldValue(fieldType FieldType, header line, valueStr string, body []line) (interface{}, error) {
+	content := nonBlank(body)
+
+	if isNull(fieldType, valueStr) {
+		if len(content) > 0 {
+			return nil, unexpectedContent(content[0])
+		}
+		return nil, nil
+	}
+
 	switch fieldType.Type {
-	case "string":
-		// Multi-line string values continue on next lines with indentation
-		if valueStr == "" && currentIndex+1 < len(lines) {
-			// Check next line for indented content
-			nextLine := lines[currentIndex+1]
-			if strings.HasPrefix(nextLine, "    ") || strings.HasPrefix(nextLine, "\t") {
-				return strings.TrimSpace(nextLine), currentIndex + 2, nil
+	case "array":
+		return parseArrayBlock(fieldType, -1, header, valueStr, body)
+
+	case "object":
+		if valueStr != "" {
+			if len(content) > 0 {
+				return nil, unexpectedContent(content[0])
 			}
+			text, column := unwrapObjectLine(valueStr, valueColumn(header, valueStr))
+			obj, err := parseObjectFromLine(text, column, &fieldType)
+			return obj, annotate(err, "", header.num, 0)
 		}
-		return valueStr, currentIndex + 1, nil
+		if len(content) == 1 && !isObjectFieldHeader(content[0], fieldType) {
+			// Object values on a single pipe-separated line
+			text, column := unwrapObjectLine(strings.TrimSpace(content[0].text), content[0].indent()+1)
+			obj, err := parseObjectFromLine(text, column, &fieldType)
+			return obj, annotate(err, "", content[0].num, 0)
+		}
+		return parseObjectBlock(fieldType, body)
 
-	case "int", "int32", "int64":
-		// Check for multi-line value
-		if valueStr == "" && currentIndex+1 < len(lines) {
-			nextLine := strings.TrimSpace(lines[currentIndex+1])
-			if nextLine != "" && !strings.Contains(nextLine, ":") {
-				valueStr = nextLine
-				currentIndex++
+	case "union":
+		if valueStr != "" {
+			if len(content) > 0 {
+				return nil, unexpectedContent(content[0])
 			}
+			obj, err := parseUnionFromLine(valueStr, valueColumn(header, valueStr), fieldType)
+			return obj, annotate(err, "", header.num, 0)
 		}
-		
-		val, err := strconv.ParseInt(strings.TrimSpace(valueStr), 10, 64)
-		if err != nil {
-			return nil, currentIndex, fmt.Errorf("invalid integer value: %s", valueStr)
+		if len(content) == 1 && !isUnionFieldHeader(content[0], fieldType) {
+			// Union values on a single pipe-separated line
+			text := strings.TrimSpace(content[0].text)
+			obj, err := parseUnionFromLine(text, content[0].indent()+1, fieldType)
+			return obj, annotate(err, "", content[0].num, 0)
 		}
-		return int(val), currentIndex + 1, nil
+		return parseUnionBlock(fieldType, body)
 
-	case "float32":
-		// Check for multi-line value
-		if valueStr == "" && currentIndex+1 < len(lines) {
-			nextLine := strings.TrimSpace(lines[currentIndex+1])
-			if nextLine != "" && !strings.Contains(nextLine, ":") {
-				valueStr = nextLine
-				currentIndex++
+	case "map":
+		if valueStr != "" {
+			if len(content) > 0 {
+				return nil, unexpectedContent(content[0])
 			}
+			value, err := parseInlineValue(fieldType, valueStr, valueColumn(header, valueStr))
+			return value, annotate(err, "", header.num, 0)
 		}
-		
-		val, err := strconv.ParseFloat(strings.TrimSpace(valueStr), 32)
+		return parseMapBlock(fieldType, body)
+	}
+
+	if fieldType.Type == "string" && isBlockIndicator(valueStr) {
+		return parseBlockString(valueStr, body)
+	}
+
+	// Simple values appear on the header line or alone on the next line
+	valueLine := header
+	if valueStr == "" {
+		switch len(content) {
+		case 0:
+			if fieldType.Type != "string" {
+				return nil, &SyntaxError{Position: Position{Line: header.num}, Msg: fmt.Sprintf("missing %s value", fieldType.Type)}
+			}
+		case 1:
+			valueLine = content[0]
+			valueStr = strings.TrimSpace(valueLine.text)
+		default:
+			return nil, unexpectedContent(content[1])
+		}
+	} else if len(content) > 0 {
+		return nil, unexpectedContent(content[0])
+	}
+
+	value, err := parseInlineValue(fieldType, valueStr, valueColumn(valueLine, valueStr))
+	return value, annotate(err, "", valueLine.num, 0)
+}
+
+// isNull reports whether a value is the null literal of a nullable type. For types that
+// are not nullable, an unquoted null is parsed as an ordinary value.
+func isNull(fieldType FieldType, valueStr string) bool {
+	return fieldType.Nullable && valueStr == "null"
+}
+
+// isBlockIndicator reports whether a header value opens a block string
+func isBlockIndicator(valueStr string) bool {
+	return valueStr == "|" || valueStr == "|-" || valueStr == "|+"
+}
+
+// parseBlockString reads a multi-line block string. The content indentation is taken from
+// the first non-blank line and stripped from every line. The indicator controls trailing
+// line breaks: "|" keeps a single one, "|-" strips them all and "|+" keeps them all.
+func parseBlockString(indicator string, body []line) (string, error) {
+	contentIndent := -1
+	lines := make([]string, 0, len(body))
+
+	for _, l := range body {
+		if l.blank() {
+			lines = append(lines, "")
+			continue
+		}
+		if contentIndent == -1 {
+			contentIndent = l.indent()
+		}
+		if l.indent() < contentIndent {
+			return "", &SyntaxError{Position: Position{Line: l.num, Column: l.indent() + 1}, Text: strings.TrimSpace(l.text), Msg: "inconsistent block string indentation"}
+		}
+		lines = append(lines, l.text[contentIndent:])
+	}
+
+	if indicator == "|+" {
+		if len(lines) == 0 {
+			return "", nil
+		}
+		return strings.Join(lines, "\n") + "\n", nil
+	}
+
+	// Drop trailing blank lines before applying the indicator
+	end := len(lines)
+	for end > 0 && lines[end-1] == "" {
+		end--
+	}
+	text := strings.Join(lines[:end], "\n")
+	if indicator == "|" && end > 0 {
+		text += "\n"
+	}
+	return text, nil
+}
+
+// parseScalarValue converts the text of a simple value according to its type
+func parseScalarValue(fieldType FieldType, valueStr string) (interface{}, error) {
+	switch fieldType.Type {
+	case "string":
+		return parseStringValue(valueStr)
+
+	case "int", "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64":
+		return parseIntegerValue(fieldType, valueStr)
+
+	case "float32":
+		val, err := strconv.ParseFloat(valueStr, 32)
 		if err != nil {
-			return nil, currentIndex, fmt.Errorf("invalid float32 value: %s", valueStr)
+			return nil, fmt.Errorf("invalid float32 value: %s", valueStr)
 		}
-		return float32(val), currentIndex + 1, nil
+		return float32(val), nil
 
 	case "float64":
-		// Check for multi-line value
-		if valueStr == "" && currentIndex+1 < len(lines) {
-			nextLine := strings.TrimSpace(lines[currentIndex+1])
-			if nextLine != "" && !strings.Contains(nextLine, ":") {
-				valueStr = nextLine
-				currentIndex++
-			}
-		}
-		
-		val, err := strconv.ParseFloat(strings.TrimSpace(valueStr), 64)
+		val, err := strconv.ParseFloat(valueStr, 64)
 		if err != nil {
-			return nil, currentIndex, fmt.Errorf("invalid float64 value: %s", valueStr)
+			return nil, fmt.Errorf("invalid float64 value: %s", valueStr)
 		}
-		return val, currentIndex + 1, nil
+		return val, nil
 
 	case "bool":
-		// Check for multi-line value
-		if valueStr == "" && currentIndex+1 < len(lines) {
-			nextLine := strings.TrimSpace(lines[currentIndex+1])
-			if nextLine != "" && !strings.Contains(nextLine, ":") {
-				valueStr = nextLine
-				currentIndex++
-			}
-		}
-		
-		val, err := strconv.ParseBool(strings.TrimSpace(valueStr))
+		val, err := strconv.ParseBool(valueStr)
 		if err != nil {
-			return nil, currentIndex, fmt.Errorf("invalid boolean value: %s", valueStr)
+			return nil, fmt.Errorf("invalid boolean value: %s", valueStr)
 		}
-		return val, currentIndex + 1, nil
+		return val, nil
 
-	case "array":
-		return parseArray(fieldType, valueStr, lines, currentIndex)
+	case "timestamp", "date", "duration":
+		return parseTemporalValue(fieldType, valueStr)
 
-	case "object":
-		return parseObject(fieldType, valueStr, lines, currentIndex)
+	case "bytes":
+		return parseBytesValue(fieldType, valueStr)
+
+	case "enum":
+		return parseEnumValue(fieldType, valueStr)
+
+	case "decimal":
+		return parseDecimalValue(fieldType, valueStr)
 
 	default:
-		return nil, currentIndex, fmt.Errorf("unknown type: %s", fieldType.Type)
+		return nil, fmt.Errorf("unknown type: %s", fieldType.Type)
 	}
 }
 
-// parseArray parses an array value
-func parseArray(fieldType FieldType, valueStr string, lines []string, currentIndex int) ([]interface{}, int, error) {
-	// Check if values are on the same line (pipe-separated)
-	if valueStr != "" && strings.Contains(valueStr, "|") {
-		values := strings.Split(valueStr, "|")
-		result := make([]interface{}, len(values))
-		for i, v := range values {
-			result[i] = strings.TrimSpace(v)
-		}
-		return result, currentIndex + 1, nil
+// isObjectFieldHeader reports whether a line is a "field: value" entry of the given object type
+func isObjectFieldHeader(l line, fieldType FieldType) bool {
+	name, _, _, err := parseFieldHeader(l)
+	if err != nil {
+		return false
 	}
+	_, exists := fieldType.ObjectFields[name]
+	return exists
+}
 
-	// For multi-line arrays, use a reasonable default size
-	// This function is used for legacy parsing; new code should use parseArrayWithSize
-	var arraySize = 50000 // Default size for compatibility
-
-	// Parse multi-line array elements
-	result := make([]interface{}, 0, arraySize)
-	i := currentIndex + 1
+// parseObjectBlock parses an object written one "field: value" entry per line
+func parseObjectBlock(fieldType FieldType, body []line) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
 
-	for i < len(lines) {
-		line := lines[i]
-		
-		// Check if line is indented (part of array)
-		if !strings.HasPrefix(line, "    ") && !strings.HasPrefix(line, "\t") {
-			break
+	for _, block := range splitBlocks(body) {
+		name, size, valueStr, err := parseFieldHeader(block.header)
+		if err != nil {
+			return nil, err
 		}
 
-		trimmedLine := strings.TrimSpace(line)
-		if trimmedLine == "" {
-			i++
-			continue
+		fieldDef, exists := fieldType.ObjectFields[name]
+		if !exists {
+			return nil, unknownField(block.header, name)
 		}
 
-		// Check if we've reached the default array size limit
-		if len(result) >= arraySize {
-			break
+		value, err := parseEntryValue(fieldDef, size, block.header, valueStr, block.body)
+		if err != nil {
+			return nil, annotate(err, name, block.header.num, 0)
 		}
 
-		// Parse array element based on element type
-		if fieldType.ElementType != nil && fieldType.ElementType.Type == "object" {
-			// Parse object from pipe-separated values
-			obj, _, err := parseObjectFromLine(trimmedLine, fieldType.ElementType)
-			if err != nil {
-				return nil, i, err
-			}
-			result = append(result, obj)
-		} else {
-			// Simple value
-			result = append(result, trimmedLine)
+		result[name] = value
+	}
+
+	if name := missingRequired(result, fieldType); name != "" {
+		return nil, &SchemaError{Position: Position{Path: name}, Msg: "missing required field"}
+	}
+	return result, nil
+}
+
+// parseEntryValue parses the value of an object field or map entry opened by header, which
+// declares size for arrays
+func parseEntryValue(fieldType FieldType, size int, header line, valueStr string, body []line) (interface{}, error) {
+	if fieldType.Type == "array" && !(size == -1 && isNull(fieldType, valueStr)) {
+		return parseArrayBlock(fieldType, size, header, valueStr, body)
+	}
+	if size != -1 {
+		return nil, nonArraySize(header)
+	}
+	return parseFieldValue(fieldType, header, valueStr, body)
+}
+
+// unknownField reports a field header whose name is not declared in the schema
+func unknownField(header line, name string) error {
+	return &SchemaError{Position: Position{Line: header.num, Column: header.indent() + 1, Path: name}, Text: name, Msg: "unknown field"}
+}
+
+// nonArraySize reports an array size declared on the header of a field that is not an array
+func nonArraySize(header line) error {
+	return &SchemaError{Position: Position{Line: header.num, Column: header.indent() + 1}, Text: strings.TrimSpace(header.text), Msg: "array size declared for non-array field"}
+}
+
+// sizeMismatch reports an array whose element count differs from its declared size
+func sizeMismatch(lineNum, declared, found int) error {
+	return &SchemaError{Position: Position{Line: lineNum}, Msg: fmt.Sprintf("array size mismatch: declared %d, found %d elements", declared, found)}
+}
+
+// parseInlineArray parses the pipe-separated elements written on an array's header line,
+// starting at column
+func parseInlineArray(fieldType FieldType, valueStr string, column int, declaredSize int) ([]interface{}, error) {
+	values, offsets := splitPipeOffsets(valueStr)
+	// Validate that the number of values matches the declared size
+	if declaredSize >= 0 && len(values) != declaredSize {
+		err := sizeMismatch(0, declaredSize, len(values))
+		return nil, annotate(err, "", 0, column)
+	}
+
+	result := make([]interface{}, len(values))
+	for i, v := range values {
+		v, elemColumn := trimValue(v, column+offsets[i])
+		elem, err := parseSimpleElement(fieldType, v, elemColumn)
+		if err != nil {
+			return nil, annotate(err, elementSegment(i), 0, elemColumn)
 		}
-		
-		i++
+		result[i] = elem
 	}
+	return result, nil
+}
 
-	return result, i, nil
+// parseSimpleElement converts an element of a simple-type array according to the element type
+func parseSimpleElement(arrayType FieldType, valueStr string, column int) (interface{}, error) {
+	if arrayType.ElementType == nil {
+		return valueStr, nil
+	}
+	return parseInlineValue(*arrayType.ElementType, valueStr, column)
 }
 
-// parseObject parses an object value
-func parseObject(fieldType FieldType, valueStr string, lines []string, currentIndex int) (map[string]interface{}, int, error) {
-	result := make(map[string]interface{})
-	
-	// Check if object is on same line (pipe-separated)
-	if valueStr != "" && strings.Contains(valueStr, "|") {
-		obj, _, err := parseObjectFromLine(valueStr, &fieldType)
-		return obj, currentIndex + 1, err
+// parseInlineValue converts a value nested inside a pipe-separated line, starting at column.
+// Objects are written as {v1|v2} and arrays as [e1|e2], so values can nest to any depth.
+func parseInlineValue(fieldType FieldType, valueStr string, column int) (interface{}, error) {
+	if isNull(fieldType, valueStr) {
+		return nil, nil
 	}
-	
-	// Multi-line object parsing
-	i := currentIndex + 1
-	
-	// Check if next line contains pipe-separated values
-	if i < len(lines) {
-		nextLine := strings.TrimSpace(lines[i])
-		if nextLine != "" && strings.Contains(nextLine, "|") {
-			obj, _, err := parseObjectFromLine(nextLine, &fieldType)
-			return obj, i + 1, err
+
+	switch fieldType.Type {
+	case "object":
+		inner, ok := unwrapInline(valueStr, '{', '}')
+		if !ok {
+			return nil, &SyntaxError{Position: Position{Column: column}, Text: valueStr, Msg: "invalid object value: " + valueStr}
+		}
+		return parseObjectFromLine(inner, column+1, &fieldType)
+
+	case "union":
+		inner, ok := unwrapInline(valueStr, '{', '}')
+		if !ok {
+			return nil, &SyntaxError{Position: Position{Column: column}, Text: valueStr, Msg: "invalid object value: " + valueStr}
+		}
+		return parseUnionFromLine(inner, column+1, fieldType)
+
+	case "map":
+		inner, ok := unwrapInline(valueStr, '{', '}')
+		if !ok {
+			return nil, &SyntaxError{Position: Position{Column: column}, Text: valueStr, Msg: "invalid map value: " + valueStr}
+		}
+		return parseInlineMap(fieldType, inner, column+1)
+
+	case "array":
+		inner, ok := unwrapInline(valueStr, '[', ']')
+		if !ok {
+			return nil, &SyntaxError{Position: Position{Column: column}, Text: valueStr, Msg: "invalid array value: " + valueStr}
 		}
+		if strings.TrimSpace(inner) == "" {
+			return []interface{}{}, nil
+		}
+		return parseInlineArray(fieldType, inner, column+1, -1)
+
+	case "string":
+		value, err := parseScalarValue(fieldType, valueStr)
+		if err != nil {
+			return nil, &SyntaxError{Position: Position{Column: column}, Text: valueStr, Msg: err.Error()}
+		}
+		return value, nil
+
+	default:
+		value, err := parseScalarValue(fieldType, valueStr)
+		if err != nil {
+			return nil, &TypeError{Position: Position{Column: column}, Text: valueStr, Type: fieldTypeToString(fieldType), Msg: err.Error()}
+		}
+		return value, nil
 	}
-	
-	// Parse field-by-field
-	fieldOrder := getFieldOrder(fieldType.ObjectFields)
-	for _, fieldName := range fieldOrder {
-		if i >= len(lines) {
-			break
+}
+
+// unwrapInline strips the open and close brackets surrounding a nested value
+func unwrapInline(valueStr string, open, close byte) (string, bool) {
+	if len(valueStr) < 2 || valueStr[0] != open || valueStr[len(valueStr)-1] != close {
+		return "", false
+	}
+	return valueStr[1 : len(valueStr)-1], true
+}
+
+// parseArrayBlock parses a complete array whose elements are inline on the header line
+// or nested below it
+func parseArrayBlock(fieldType FieldType, declaredSize int, header line, valueStr string, body []line) ([]interface{}, error) {
+	if valueStr != "" {
+		if content := nonBlank(body); len(content) > 0 {
+			return nil, unexpectedContent(content[0])
 		}
-		
-		line := strings.TrimSpace(lines[i])
-		if line == "" {
-			i++
-			continue
+		elems, err := parseInlineArray(fieldType, valueStr, valueColumn(header, valueStr), declaredSize)
+		return elems, annotate(err, "", header.num, 0)
+	}
+
+	blocks := splitBlocks(body)
+	if declaredSize >= 0 && len(blocks) != declaredSize {
+		return nil, sizeMismatch(header.num, declaredSize, len(blocks))
+	}
+
+	result := make([]interface{}, 0, len(blocks))
+	for i, block := range blocks {
+		elem, err := parseElement(fieldType, i, block.header, block.body)
+		if err != nil {
+			return nil, err
 		}
-		
-		// Parse "fieldName: value" format
-		if strings.HasPrefix(line, fieldName+":") {
-			valueStr := strings.TrimSpace(strings.TrimPrefix(line, fieldName+":"))
-			fieldDef := fieldType.ObjectFields[fieldName]
-			
-			value, newIndex, err := parseValue(fieldDef, valueStr, lines, i)
-			if err != nil {
-				return nil, i, err
-			}
-			
-			result[fieldName] = value
-			i = newIndex
+		result = append(result, elem)
+	}
+	return result, nil
+}
+
+// parseElement parses the element at index from a line of a multi-line array. Elements that
+// are arrays themselves open with a "[N]:" header and may continue in the nested body lines.
+func parseElement(arrayType FieldType, index int, l line, body []line) (interface{}, error) {
+	elem, err := parseElementValue(arrayType, l, body)
+	if err != nil {
+		return nil, annotate(err, elementSegment(index), l.num, l.indent()+1)
+	}
+	return elem, nil
+}
+
+// parseElementValue parses the value of a single element of a multi-line array
+func parseElementValue(arrayType FieldType, l line, body []line) (interface{}, error) {
+	elemType := arrayType.ElementType
+	if elemType != nil && elemType.Type == "array" && isElementArrayHeader(l) {
+		_, size, valueStr, err := parseFieldHeader(l)
+		if err != nil {
+			return nil, err
 		}
+		return parseArrayBlock(*elemType, size, l, valueStr, body)
 	}
-	
-	return result, i, nil
+
+	if content := nonBlank(body); len(content) > 0 {
+		return nil, unexpectedContent(content[0])
+	}
+
+	trimmedLine := strings.TrimSpace(l.text)
+	column := l.indent() + 1
+
+	// Parse array element based on element type
+	if elemType != nil && elemType.Type == "object" && !isNull(*elemType, trimmedLine) {
+		// Parse object from pipe-separated values
+		text, textColumn := unwrapObjectLine(trimmedLine, column)
+		return parseObjectFromLine(text, textColumn, elemType)
+	}
+	if elemType != nil && elemType.Type == "union" && !isNull(*elemType, trimmedLine) {
+		return parseUnionFromLine(trimmedLine, column, *elemType)
+	}
+
+	// Simple value
+	return parseSimpleElement(arrayType, trimmedLine, column)
+}
+
+// unwrapObjectLine removes the braces around the pipe line of an object standing alone on
+// a line, which the writer adds to lines that would otherwise be blank, null or a single
+// nested object, and returns the column the unwrapped line starts at
+func unwrapObjectLine(text string, column int) (string, int) {
+	if isBraced(text) {
+		return text[1 : len(text)-1], column + 1
+	}
+	return text, column
 }
 
-// parseObjectFromLine parses an object from a pipe-separated line
-func parseObjectFromLine(line string, fieldType *FieldType) (map[string]interface{}, int, error) {
-	values := strings.Split(line, "|")
+// isBraced reports whether s is a single value wrapped in braces, such as {1|2}
+func isBraced(s string) bool {
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return false
+	}
+	values, _ := splitPipeOffsets(s)
+	return len(values) == 1
+}
+
+// isElementArrayHeader reports whether a line opens a nested array element with "[N]:"
+func isElementArrayHeader(l line) bool {
+	text := strings.TrimSpace(l.text)
+	end := strings.Index(text, "]:")
+	return strings.HasPrefix(text, "[") && end > 0 && !strings.ContainsAny(text[:end], "|\"")
+}
+
+// parseObjectFromLine parses an object from a pipe-separated line starting at column.
+// An empty, unquoted position means the field is absent.
+func parseObjectFromLine(line string, column int, fieldType *FieldType) (map[string]interface{}, error) {
+	values, offsets := splitPipeOffsets(line)
 	result := make(map[string]interface{})
-	
+	if strings.TrimSpace(line) == "" {
+		// An empty line, such as the {} of an empty nested object, holds no values
+		values = nil
+	}
+
 	fieldOrder := getObjectFieldOrder(fieldType)
-	
-	for i, fieldName := range fieldOrder {
-		if i >= len(values) {
-			break
+	if len(values) > len(fieldOrder) {
+		return nil, &SyntaxError{
+			Position: Position{Column: column + offsets[len(fieldOrder)]},
+			Text:     line,
+			Msg:      fmt.Sprintf("too many values: expected %d, found %d", len(fieldOrder), len(values)),
 		}
-		
+	}
+
+	for i, valueStr := range values {
+		fieldName := fieldOrder[i]
 		fieldDef := fieldType.ObjectFields[fieldName]
-		valueStr := strings.TrimSpace(values[i])
-		
+		valueStr, valueColumn := trimValue(valueStr, column+offsets[i])
+		if valueStr == "" {
+			continue
+		}
+
 		// Convert value based on field type
-		switch fieldDef.Type {
-		case "int", "int32", "int64":
-			val, err := strconv.ParseInt(valueStr, 10, 64)
-			if err != nil {
-				return nil, 0, fmt.Errorf("invalid integer for field %s: %s", fieldName, valueStr)
-			}
-			result[fieldName] = int(val)
-			
-		case "float32":
-			val, err := strconv.ParseFloat(valueStr, 32)
-			if err != nil {
-				return nil, 0, fmt.Errorf("invalid float32 for field %s: %s", fieldName, valueStr)
+		value, err := parseInlineValue(fieldDef, valueStr, valueColumn)
+		if err != nil {
+			return nil, annotate(err, fieldName, 0, valueColumn)
+		}
+		result[fieldName] = value
+	}
+
+	if name := missingRequired(result, *fieldType); name != "" {
+		return nil, &SchemaError{Position: Position{Column: column, Path: name}, Text: line, Msg: "missing required field"}
+	}
+	return result, nil
+}
+
+// trimValue trims the whitespace around a value found at column, returning the value
+// and the column of its first character
+func trimValue(s string, column int) (string, int) {
+	trimmed := strings.TrimLeft(s, " \t")
+	return strings.TrimRight(trimmed, " \t"), column + len(s) - len(trimmed)
+}
+
+// splitPipeOffsets splits a line on '|' delimiters, keeping delimiters inside quoted strings
+// and nested {...} or [...] values, and returns the byte offset at which each part starts. A
+// quoted string starts with '"' at the beginning of a value and uses backslash escapes.
+func splitPipeOffsets(s string) ([]string, []int) {
+	var parts []string
+	offsets := []int{0}
+	start := 0
+	depth := 0
+	atStart := true // only whitespace seen since the start of the current value
+	inQuotes := false
+
+	// Delimiters are ASCII, so scanning bytes is safe for UTF-8 input
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inQuotes:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inQuotes = false
 			}
-			result[fieldName] = float32(val)
-			
-		case "float64":
-			val, err := strconv.ParseFloat(valueStr, 64)
-			if err != nil {
-				return nil, 0, fmt.Errorf("invalid float64 for field %s: %s", fieldName, valueStr)
+		case c == '|':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+				offsets = append(offsets, start)
 			}
-			result[fieldName] = val
-			
-		case "bool":
-			val, err := strconv.ParseBool(valueStr)
-			if err != nil {
-				return nil, 0, fmt.Errorf("invalid boolean for field %s: %s", fieldName, valueStr)
+			atStart = true
+		case c == '"' && atStart:
+			inQuotes = true
+			atStart = false
+		case c == '{' || c == '[':
+			depth++
+			atStart = true
+		case c == '}' || c == ']':
+			if depth > 0 {
+				depth--
 			}
-			result[fieldName] = val
-			
-		default:
-			result[fieldName] = valueStr
+			atStart = false
+		case c != ' ' && c != '\t':
+			atStart = false
 		}
 	}
-	
-	return result, 0, nil
+
+	return append(parts, s[start:]), offsets
 }
 
-// getFieldOrder returns field names in their original order
-func getFieldOrder(fields map[string]FieldType) []string {
-	// Try to get the order from ObjectOrder if available
-	for _, field := range fields {
-		if field.Type == "object" && len(field.ObjectOrder) > 0 {
-			return field.ObjectOrder
-		}
+// parseStringValue returns the string held by a value, unquoting it when it is written
+// as a quoted string
+func parseStringValue(valueStr string) (string, error) {
+	if !strings.HasPrefix(valueStr, `"`) {
+		return valueStr, nil
 	}
-	
-	names := make([]string, 0, len(fields))
-	for name := range fields {
-		names = append(names, name)
+	s, err := strconv.Unquote(valueStr)
+	if err != nil {
+		return "", fmt.Errorf("invalid quoted string: %s", valueStr)
 	}
-	
-	// Sort alphabetically for consistency
-	for i := 0; i < len(names)-1; i++ {
-		for j := i + 1; j < len(names); j++ {
-			if names[i] > names[j] {
-				names[i], names[j] = names[j], names[i]
-			}
-		}
-	}
-	
-	return names
+	return s, nil
 }
 
 // getObjectFieldOrder returns field names in their original object definition order
@@ -310,4 +740,4 @@ func getObjectFieldOrder(fieldType *FieldType) []string {
 	}
 	
 	return []string{}
-}
\ No newline at end of file
+}
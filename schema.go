@@ -2,69 +2,247 @@ package metadat
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Schema represents the metadata structure
 type Schema struct {
 	Fields     map[string]FieldType
-	FieldOrder []string // preserve original field order
+	FieldOrder []string             // preserve original field order
+	Types      map[string]FieldType // named types declared with "type Name = type"
+	TypeOrder  []string             // preserve type declaration order
+	Imports    []string             // schema files named by import directives
 }
 
+// arrayDocumentField is the name under which an array document stores its root array.
+// The meta section declares it as "[]: recordType" and the data section lists its rows
+// under a "[N]:" header.
+const arrayDocumentField = ""
+
 // FieldType represents a field's type information
 type FieldType struct {
-	Type         string                 // basic type: string, int, float32, float64, bool, array, object
-	ElementType  *FieldType             // for arrays
-	ObjectFields map[string]FieldType   // for objects
-	ObjectOrder  []string              // preserve object field order
-	Name         string                 // field name (used in arrays/objects)
+	Type          string               // basic type: string, int, float32, float64, bool, array, object
+	ElementType   *FieldType           // for arrays, and the value type of maps
+	ObjectFields  map[string]FieldType // for objects
+	ObjectOrder   []string             // preserve object field order
+	Name          string               // field name (used in arrays/objects)
+	Nullable      bool                 // value may be null, written as "type?"
+	Required      bool                 // field must be present, written as "name!"
+	Encoding      string               // for bytes: "hex", or empty for base64
+	EnumValues    []string             // for enums, in declaration order
+	Precision     int                  // for decimal(p,s): total digits, 0 when not declared
+	Scale         int                  // for decimal(p,s): digits after the decimal point
+	Discriminator string               // for unions: field holding the variant name
+	Variants      map[string]FieldType // for unions: object type of each variant
+	VariantOrder  []string             // preserve variant order
+	TypeName      string               // for references to named types: the type name
 }
 
-// parseSchema parses the meta section into a Schema
+// parseSchema parses the meta section into a Schema, reporting the first error
 func parseSchema(metaContent string) (Schema, error) {
+	schema, errs := parseSchemaAll(metaContent, newImporter(nil, ""))
+	if len(errs) > 0 {
+		return schema, errs[0]
+	}
+	return schema, nil
+}
+
+// parseSchemaAll parses the meta section into a Schema, reporting every error
+func parseSchemaAll(metaContent string, imports *importer) (Schema, ErrorList) {
+	var lines []line
+	for i, text := range strings.Split(metaContent, "\n") {
+		lines = append(lines, line{num: i + 1, text: strings.TrimRight(text, "\r")})
+	}
+	return parseSchemaLines(lines, imports)
+}
+
+// parseSchemaLines parses the lines of a meta section into a Schema, following its import
+// directives with imports. Every error is reported as a *SchemaError positioned at the
+// offending line, and the offending field is left out.
+func parseSchemaLines(lines []line, imports *importer) (Schema, ErrorList) {
+	var errs ErrorList
 	schema := Schema{
 		Fields:     make(map[string]FieldType),
 		FieldOrder: make([]string, 0),
 	}
-	lines := strings.Split(strings.TrimSpace(metaContent), "\n")
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
+	// Named types are collected first so that fields and other types may refer to
+	// them wherever they are declared. Imported types are already resolved.
+	scope := make(typeScope)
+	origins := make(map[string]string) // file each imported type comes from
+	var typeOrder []string
+	typeLines := make(map[string]line)
+	for _, l := range lines {
+		text := strings.TrimSpace(l.text)
+		if importName, ok, err := parseImportDirective(text); ok {
+			column := valueColumn(l, strings.TrimSpace(strings.TrimPrefix(text, "import")))
+			if err != nil {
+				errs = append(errs, &SchemaError{Position: Position{Line: l.num, Column: column}, Text: text, Msg: err.Error()})
+				continue
+			}
+			if err := importTypes(imports, importName, scope, origins); err != nil {
+				errs = append(errs, &SchemaError{Position: Position{Line: l.num, Column: column}, Text: importName, Msg: fmt.Sprintf("import %q: %v", importName, err)})
+			}
+			schema.Imports = append(schema.Imports, importName)
+			continue
+		}
+
+		name, _, ok := parseTypeDeclaration(text)
+		if !ok {
+			continue
+		}
+		if err := checkTypeName(name); err != nil {
+			errs = append(errs, &SchemaError{Position: Position{Line: l.num, Column: l.indent() + 1}, Text: text, Msg: err.Error()})
+			continue
+		}
+		if _, exists := scope[name]; exists {
+			errs = append(errs, &SchemaError{Position: Position{Line: l.num, Column: l.indent() + 1}, Text: text, Msg: duplicateType(name, origins[name])})
+			continue
+		}
+		scope[name] = &FieldType{}
+		typeOrder = append(typeOrder, name)
+		typeLines[name] = l
+	}
+
+	for _, name := range typeOrder {
+		l := typeLines[name]
+		_, typeStr, _ := parseTypeDeclaration(strings.TrimSpace(l.text))
+		definition, err := parseTypeIn(typeStr, scope)
+		if err != nil {
+			errs = append(errs, &SchemaError{Position: Position{Line: l.num, Column: valueColumn(l, typeStr)}, Text: typeStr, Msg: fmt.Sprintf("error parsing type %s: %v", name, err)})
+			definition = FieldType{Type: "string"}
+		}
+		*scope[name] = definition
+	}
+
+	fieldLines := make(map[string]line)
+	for _, l := range lines {
+		text := strings.TrimSpace(l.text)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if _, _, ok := parseTypeDeclaration(text); ok {
+			continue
+		}
+		if _, ok, _ := parseImportDirective(text); ok {
 			continue
 		}
 
-		colonIndex := strings.Index(line, ":")
+		colonIndex := strings.Index(text, ":")
 		if colonIndex == -1 {
 			continue
 		}
 
-		fieldName := strings.TrimSpace(line[:colonIndex])
-		typeStr := strings.TrimSpace(line[colonIndex+1:])
+		fieldName, required := parseFieldName(text[:colonIndex])
+		typeStr := strings.TrimSpace(text[colonIndex+1:])
+		typeColumn := valueColumn(l, typeStr)
 
-		fieldType, err := parseType(typeStr)
+		if fieldName == "[]" {
+			// The document root is an array of records
+			recordType, err := parseTypeIn(typeStr, scope)
+			if err != nil {
+				errs = append(errs, &SchemaError{Position: Position{Line: l.num, Column: typeColumn}, Text: typeStr, Msg: fmt.Sprintf("error parsing record type: %v", err)})
+				continue
+			}
+			fieldName = arrayDocumentField
+			typeStr = fieldTypeToString(FieldType{Type: "array", ElementType: &recordType})
+		}
+
+		fieldType, err := parseTypeIn(typeStr, scope)
 		if err != nil {
-			return schema, fmt.Errorf("error parsing type for field %s: %v", fieldName, err)
+			errs = append(errs, &SchemaError{Position: Position{Line: l.num, Column: typeColumn, Path: fieldName}, Text: typeStr, Msg: err.Error()})
+			continue
+		}
+		fieldType.Required = required
+
+		// An array document declares its record type and nothing else
+		_, isArray := schema.Fields[arrayDocumentField]
+		if isArray || (fieldName == arrayDocumentField && len(schema.Fields) > 0) {
+			errs = append(errs, &SchemaError{Position: Position{Line: l.num, Column: l.indent() + 1}, Text: text, Msg: "an array document cannot declare other fields"})
+			continue
 		}
 
 		schema.Fields[fieldName] = fieldType
 		schema.FieldOrder = append(schema.FieldOrder, fieldName)
+		fieldLines[fieldName] = l
 	}
 
-	return schema, nil
+	if len(scope) == 0 {
+		return schema, errs
+	}
+
+	// Replace the references to named types now that every definition is known
+	for _, name := range typeOrder {
+		l := typeLines[name]
+		if err := scope.resolveAlias(name, make(map[string]bool)); err != nil {
+			errs = append(errs, &SchemaError{Position: Position{Line: l.num, Column: l.indent() + 1}, Text: name, Msg: err.Error()})
+			*scope[name] = FieldType{Type: "string"}
+		}
+	}
+	for _, name := range typeOrder {
+		l := typeLines[name]
+		if err := scope.resolve(scope[name]); err != nil {
+			errs = append(errs, &SchemaError{Position: Position{Line: l.num, Column: l.indent() + 1}, Text: name, Msg: fmt.Sprintf("error parsing type %s: %v", name, err)})
+		}
+	}
+	for _, fieldName := range schema.FieldOrder {
+		l := fieldLines[fieldName]
+		fieldType := schema.Fields[fieldName]
+		if err := scope.resolve(&fieldType); err != nil {
+			errs = append(errs, &SchemaError{Position: Position{Line: l.num, Column: l.indent() + 1, Path: fieldName}, Text: strings.TrimSpace(l.text), Msg: err.Error()})
+		}
+		schema.Fields[fieldName] = fieldType
+	}
+
+	if len(typeOrder) > 0 {
+		schema.Types = make(map[string]FieldType, len(typeOrder))
+		for _, name := range typeOrder {
+			schema.Types[name] = *scope[name]
+		}
+		schema.TypeOrder = typeOrder
+	}
+
+	return schema, errs
+}
+
+// IsArray reports whether the schema describes a document whose root is an array of records
+func (s Schema) IsArray() bool {
+	_, exists := s.Fields[arrayDocumentField]
+	return exists
 }
 
 // parseType parses a type string into a FieldType
 func parseType(typeStr string) (FieldType, error) {
+	return parseTypeIn(typeStr, nil)
+}
+
+// parseTypeIn parses a type string that may refer to the named types of scope. References
+// are left unresolved, see typeScope.
+func parseTypeIn(typeStr string, scope typeScope) (FieldType, error) {
 	typeStr = strings.TrimSpace(typeStr)
 
+	// Check for nullable type
+	if strings.HasSuffix(typeStr, "?") {
+		fieldType, err := parseTypeIn(strings.TrimSuffix(typeStr, "?"), scope)
+		if err != nil {
+			return FieldType{}, err
+		}
+		if fieldType.Nullable {
+			return FieldType{}, fmt.Errorf("invalid type: %s", typeStr)
+		}
+		fieldType.Nullable = true
+		return fieldType, nil
+	}
+
 	// Check for array type
 	if strings.HasSuffix(typeStr, "[]") {
 		elementTypeStr := strings.TrimSuffix(typeStr, "[]")
-		elementType, err := parseType(elementTypeStr)
+		elementType, err := parseTypeIn(elementTypeStr, scope)
 		if err != nil {
 			return FieldType{}, err
 		}
@@ -88,14 +266,15 @@ func parseType(typeStr string) (FieldType, error) {
 				return FieldType{}, fmt.Errorf("invalid object field format: %s", pair)
 			}
 			
-			fieldName := strings.TrimSpace(pair[:colonIndex])
+			fieldName, required := parseFieldName(pair[:colonIndex])
 			fieldTypeStr := strings.TrimSpace(pair[colonIndex+1:])
 			
-			fieldType, err := parseType(fieldTypeStr)
+			fieldType, err := parseTypeIn(fieldTypeStr, scope)
 			if err != nil {
 				return FieldType{}, err
 			}
 			fieldType.Name = fieldName
+			fieldType.Required = required
 			fields[fieldName] = fieldType
 			fieldOrder = append(fieldOrder, fieldName)
 		}
@@ -107,15 +286,70 @@ func parseType(typeStr string) (FieldType, error) {
 		}, nil
 	}
 
+	// Check for tagged union type
+	if strings.HasPrefix(typeStr, "union(") && strings.HasSuffix(typeStr, "}") {
+		return parseUnionType(typeStr, scope)
+	}
+
+	// Check for map type
+	if strings.HasPrefix(typeStr, "map<") && strings.HasSuffix(typeStr, ">") {
+		return parseMapType(typeStr[len("map<") : len(typeStr)-1], scope)
+	}
+
+	// Check for enum type
+	if strings.HasPrefix(typeStr, "enum(") && strings.HasSuffix(typeStr, ")") {
+		return parseEnumType(typeStr[len("enum(") : len(typeStr)-1])
+	}
+
+	// Check for decimal with a precision and scale, such as decimal(10,2)
+	if strings.HasPrefix(typeStr, "decimal(") && strings.HasSuffix(typeStr, ")") {
+		return parseDecimalType(typeStr[len("decimal(") : len(typeStr)-1])
+	}
+
+	// Check for bytes with an explicit encoding, such as bytes(hex)
+	if strings.HasPrefix(typeStr, "bytes(") && strings.HasSuffix(typeStr, ")") {
+		return parseBytesType(strings.TrimSpace(typeStr[len("bytes(") : len(typeStr)-1]))
+	}
+
 	// Basic type
 	switch typeStr {
-	case "string", "int", "int32", "int64", "float32", "float64", "bool":
+	case "string", "int", "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64",
+		"float32", "float64", "decimal", "bool",
+		"timestamp", "date", "duration", "bytes":
 		return FieldType{Type: typeStr}, nil
 	default:
+		if _, exists := scope[typeStr]; exists {
+			return FieldType{TypeName: typeStr}, nil
+		}
 		return FieldType{}, fmt.Errorf("unknown type: %s", typeStr)
 	}
 }
 
+// parseFieldName reads a field name from a schema definition. A trailing "!" marks
+// the field as required. Names that end in "!" themselves are written quoted.
+func parseFieldName(s string) (name string, required bool) {
+	name = strings.TrimSpace(s)
+	if strings.HasSuffix(name, "!") {
+		name, required = strings.TrimSpace(strings.TrimSuffix(name, "!")), true
+	}
+	if unquoted, err := strconv.Unquote(name); err == nil && strings.HasPrefix(name, `"`) {
+		name = unquoted
+	}
+	return name, required
+}
+
+// fieldNameToString writes a field name as it appears in a schema definition, quoting
+// names that would otherwise read back as a different name
+func fieldNameToString(name string, ft FieldType) string {
+	if strings.HasSuffix(name, "!") || strings.HasPrefix(name, `"`) {
+		name = strconv.Quote(name)
+	}
+	if ft.Required {
+		return name + "!"
+	}
+	return name
+}
+
 // splitObjectFields splits object field definitions considering nested structures
 func splitObjectFields(objectStr string) []string {
 	var fields []string
@@ -124,10 +358,10 @@ func splitObjectFields(objectStr string) []string {
 	
 	for _, ch := range objectStr {
 		switch ch {
-		case '{':
+		case '{', '(':
 			depth++
 			current.WriteRune(ch)
-		case '}':
+		case '}', ')':
 			depth--
 			current.WriteRune(ch)
 		case '|':
@@ -161,15 +395,37 @@ func (s Schema) ToString() string {
 	
 	// Get ordered field names
 	fieldNames := s.GetFieldOrder()
+
+	for _, name := range s.Imports {
+		buffer.WriteString(fmt.Sprintf("    import %s\n", strconv.Quote(name)))
+	}
+
+	// Named types are written out in full; everywhere else they appear by name
+	for _, name := range s.TypeOrder {
+		buffer.WriteString(fmt.Sprintf("    type %s = %s\n", name, fieldTypeToString(s.Types[name])))
+	}
 	
 	for _, name := range fieldNames {
 		fieldType := s.Fields[name]
-		buffer.WriteString(fmt.Sprintf("    %s: %s\n", name, fieldTypeToString(fieldType)))
+		if name == arrayDocumentField {
+			buffer.WriteString(fmt.Sprintf("    []: %s\n", fieldTypeToString(*recordType(fieldType))))
+			continue
+		}
+		buffer.WriteString(fmt.Sprintf("    %s: %s\n", fieldNameToString(name, fieldType), fieldTypeToString(fieldType)))
 	}
 	
 	return buffer.String()
 }
 
+// recordType returns the element type of an array document, defaulting to string when
+// it could not be inferred
+func recordType(fieldType FieldType) *FieldType {
+	if fieldType.ElementType == nil {
+		return &FieldType{Type: "string"}
+	}
+	return fieldType.ElementType
+}
+
 // GetFieldOrder returns field names in their original schema order
 func (s Schema) GetFieldOrder() []string {
 	if len(s.FieldOrder) > 0 {
@@ -194,8 +450,26 @@ func (s Schema) GetFieldOrder() []string {
 	return names
 }
 
+// objectType describes the whole document as a single object type
+func (s Schema) objectType() FieldType {
+	return FieldType{
+		Type:         "object",
+		ObjectFields: s.Fields,
+		ObjectOrder:  s.GetFieldOrder(),
+	}
+}
+
 // fieldTypeToString converts a FieldType to its string representation
 func fieldTypeToString(ft FieldType) string {
+	if ft.Nullable {
+		nonNull := ft
+		nonNull.Nullable = false
+		return fieldTypeToString(nonNull) + "?"
+	}
+	if ft.TypeName != "" {
+		return ft.TypeName
+	}
+
 	switch ft.Type {
 	case "array":
 		if ft.ElementType != nil {
@@ -225,82 +499,176 @@ func fieldTypeToString(ft FieldType) string {
 		
 		for _, name := range fieldNames {
 			fieldType := ft.ObjectFields[name]
-			fields = append(fields, fmt.Sprintf("%s:%s", name, fieldTypeToString(fieldType)))
+			fields = append(fields, fmt.Sprintf("%s:%s", fieldNameToString(name, fieldType), fieldTypeToString(fieldType)))
 		}
 		return "{" + strings.Join(fields, "|") + "}"
+
+	case "bytes":
+		if ft.Encoding != "" {
+			return "bytes(" + ft.Encoding + ")"
+		}
+		return ft.Type
+
+	case "map":
+		return "map<string," + fieldTypeToString(*ft.ElementType) + ">"
+
+	case "union":
+		return unionTypeToString(ft)
+
+	case "enum":
+		return "enum(" + strings.Join(ft.EnumValues, "|") + ")"
+
+	case "decimal":
+		if ft.Precision > 0 {
+			return fmt.Sprintf("decimal(%d,%d)", ft.Precision, ft.Scale)
+		}
+		return ft.Type
 		
 	default:
 		return ft.Type
 	}
 }
 
-// InferSchemaFromJSON infers a Schema from JSON data
+// InferSchemaFromJSON infers a Schema from JSON data. A root array produces the schema
+// of an array document. Go maps do not keep key order, so object fields are ordered by
+// name; use DecodeJSON to keep the order of the source document.
+// The types of all array elements are merged; where they conflict the first type is kept,
+// use InferSchemaFromSamples to have conflicts reported.
 func InferSchemaFromJSON(data interface{}) Schema {
+	rootType, _ := inferType(data, "")
+	return schemaFromType(resolveType(rootType))
+}
+
+// InferSchemaFromSamples infers a single Schema that covers every sample document.
+// Array elements and samples are merged: integers are widened to float64 when other values
+// are fractional, keys missing from some objects become optional fields, and null makes a
+// type nullable. Types that cannot be reconciled are reported as an error.
+func InferSchemaFromSamples(samples ...interface{}) (Schema, error) {
+	if len(samples) == 0 {
+		return Schema{Fields: make(map[string]FieldType)}, nil
+	}
+
+	var rootType FieldType
+	for i, sample := range samples {
+		sampleType, err := inferType(sample, "")
+		if err == nil && i > 0 {
+			sampleType, err = mergeTypes(rootType, sampleType, "")
+		}
+		if err != nil {
+			if len(samples) > 1 {
+				return Schema{}, fmt.Errorf("sample %d: %v", i, err)
+			}
+			return Schema{}, err
+		}
+		rootType = sampleType
+	}
+
+	return schemaFromType(resolveType(rootType)), nil
+}
+
+// schemaFromType builds a Schema from the inferred type of a document root
+func schemaFromType(rootType FieldType) Schema {
 	schema := Schema{
 		Fields:     make(map[string]FieldType),
 		FieldOrder: make([]string, 0),
 	}
-	
-	if obj, ok := data.(map[string]interface{}); ok {
-		for key, value := range obj {
-			schema.Fields[key] = inferFieldType(value)
+
+	switch rootType.Type {
+	case "object":
+		for _, key := range rootType.ObjectOrder {
+			schema.Fields[key] = rootType.ObjectFields[key]
 			schema.FieldOrder = append(schema.FieldOrder, key)
 		}
+	case "array":
+		rootType.ElementType = recordType(rootType)
+		schema.Fields[arrayDocumentField] = rootType
+		schema.FieldOrder = append(schema.FieldOrder, arrayDocumentField)
 	}
-	
+
 	return schema
 }
 
 // inferFieldType infers the FieldType from a value
 func inferFieldType(value interface{}) FieldType {
+	fieldType, _ := inferType(value, "")
+	return resolveType(fieldType)
+}
+
+// nullType is the type inferred for null until it is merged with the type of another value
+const nullType = "null"
+
+// inferType infers the type of a value, merging the types of all array elements.
+// On a conflict the first type is kept and the error is returned alongside it.
+func inferType(value interface{}, path string) (FieldType, error) {
 	if value == nil {
-		return FieldType{Type: "string"}
+		return FieldType{Type: nullType, Nullable: true}, nil
 	}
 	
 	switch v := value.(type) {
 	case string:
-		return FieldType{Type: "string"}
+		return FieldType{Type: "string"}, nil
 		
 	case float64:
 		// JSON numbers are always float64
 		if v == float64(int(v)) {
-			return FieldType{Type: "int"}
+			return FieldType{Type: "int"}, nil
 		}
-		return FieldType{Type: "float64"}
+		return FieldType{Type: "float64"}, nil
 		
-	case int, int32, int64:
-		return FieldType{Type: "int"}
+	case int, int8, int16, int32, int64, uint8, uint16, uint32:
+		return FieldType{Type: "int"}, nil
+
+	case uint, uint64:
+		return FieldType{Type: "uint64"}, nil
 		
 	case float32:
-		return FieldType{Type: "float32"}
+		return FieldType{Type: "float32"}, nil
 		
 	case bool:
-		return FieldType{Type: "bool"}
+		return FieldType{Type: "bool"}, nil
+
+	case time.Time:
+		return FieldType{Type: "timestamp"}, nil
+
+	case time.Duration:
+		return FieldType{Type: "duration"}, nil
+
+	case []byte:
+		return FieldType{Type: "bytes"}, nil
+
+	case Decimal:
+		return FieldType{Type: "decimal"}, nil
 		
 	case []interface{}:
-		// Infer array element type from first element
+		// Merge the types of every element
 		var elementType *FieldType
-		if len(v) > 0 {
-			inferred := inferFieldType(v[0])
+		var firstErr error
+		for i, elem := range v {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			inferred, err := inferType(elem, elemPath)
+			if err == nil && elementType != nil {
+				inferred, err = mergeTypes(*elementType, inferred, elemPath)
+			}
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				if elementType != nil {
+					continue
+				}
+			}
 			elementType = &inferred
 		}
 		return FieldType{
 			Type:        "array",
 			ElementType: elementType,
-		}
+		}, firstErr
 		
 	case map[string]interface{}:
-		fields := make(map[string]FieldType)
-		objectOrder := make([]string, 0, len(v))
-		for key, val := range v {
-			fields[key] = inferFieldType(val)
-			objectOrder = append(objectOrder, key)
-		}
-		return FieldType{
-			Type:         "object",
-			ObjectFields: fields,
-			ObjectOrder:  objectOrder,
-		}
+		return inferObjectType(sortedKeys(v), v, path)
+
+	case *jsonObject:
+		return inferObjectType(v.keys, v.values, path)
 		
 	default:
 		// Check if it's a slice of a specific type
@@ -310,116 +678,380 @@ func inferFieldType(value interface{}) FieldType {
 			return FieldType{
 				Type: "array",
 				ElementType: &FieldType{Type: "string"}, // Default to string
+			}, nil
+		}
+		return FieldType{Type: "string"}, nil
+	}
+}
+
+// inferObjectType infers an object type whose fields are ordered by keys
+func inferObjectType(keys []string, values map[string]interface{}, path string) (FieldType, error) {
+	fields := make(map[string]FieldType, len(keys))
+	var firstErr error
+	for _, key := range keys {
+		fieldType, err := inferType(values[key], joinPath(path, key))
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		fields[key] = fieldType
+	}
+	return FieldType{
+		Type:         "object",
+		ObjectFields: fields,
+		ObjectOrder:  append([]string(nil), keys...),
+	}, firstErr
+}
+
+// mergeTypes returns a type that describes values of both a and b
+func mergeTypes(a, b FieldType, path string) (FieldType, error) {
+	if a.Type == nullType {
+		b.Nullable = true
+		return b, nil
+	}
+	if b.Type == nullType {
+		a.Nullable = true
+		return a, nil
+	}
+
+	var merged FieldType
+	switch {
+	case a.Type == "array" && b.Type == "array":
+		merged = FieldType{Type: "array", ElementType: a.ElementType}
+		if a.ElementType == nil {
+			merged.ElementType = b.ElementType
+		} else if b.ElementType != nil {
+			elementType, err := mergeTypes(*a.ElementType, *b.ElementType, path+"[]")
+			if err != nil {
+				return a, err
 			}
+			merged.ElementType = &elementType
+		}
+
+	case a.Type == "map" && b.Type == "map":
+		elementType, err := mergeTypes(*a.ElementType, *b.ElementType, path+"[]")
+		if err != nil {
+			return a, err
+		}
+		merged = FieldType{Type: "map", ElementType: &elementType}
+
+	case a.Type == "object" && b.Type == "object":
+		// Keys missing from either side stay optional
+		merged = FieldType{
+			Type:         "object",
+			ObjectFields: make(map[string]FieldType, len(a.ObjectFields)),
+			ObjectOrder:  append([]string(nil), a.ObjectOrder...),
+		}
+		for name, fieldType := range a.ObjectFields {
+			merged.ObjectFields[name] = fieldType
+		}
+		for _, name := range b.ObjectOrder {
+			fieldType := b.ObjectFields[name]
+			existing, exists := merged.ObjectFields[name]
+			if !exists {
+				merged.ObjectFields[name] = fieldType
+				merged.ObjectOrder = append(merged.ObjectOrder, name)
+				continue
+			}
+			mergedField, err := mergeTypes(existing, fieldType, joinPath(path, name))
+			if err != nil {
+				return a, err
+			}
+			merged.ObjectFields[name] = mergedField
+		}
+
+	case a.Type == b.Type:
+		merged = FieldType{Type: a.Type}
+
+	case isNumericType(a.Type) && isNumericType(b.Type):
+		// Whole numbers widen to the fractional type
+		merged = FieldType{Type: "float64"}
+
+	default:
+		return a, fmt.Errorf("conflicting types for %s: %s and %s", describePath(path), fieldTypeToString(resolveType(a)), fieldTypeToString(resolveType(b)))
+	}
+
+	merged.Nullable = a.Nullable || b.Nullable
+	return merged, nil
+}
+
+// isNumericType reports whether t is an integer or floating point type
+func isNumericType(t string) bool {
+	if isIntegerType(t) {
+		return true
+	}
+	switch t {
+	case "float32", "float64":
+		return true
+	}
+	return false
+}
+
+// resolveType replaces types that could not be inferred, from null values or empty arrays,
+// with nullable strings and string elements
+func resolveType(fieldType FieldType) FieldType {
+	switch fieldType.Type {
+	case nullType:
+		fieldType.Type = "string"
+
+	case "array":
+		elementType := FieldType{Type: "string"}
+		if fieldType.ElementType != nil {
+			elementType = resolveType(*fieldType.ElementType)
+		}
+		fieldType.ElementType = &elementType
+
+	case "map":
+		elementType := resolveType(*fieldType.ElementType)
+		fieldType.ElementType = &elementType
+
+	case "object":
+		fields := make(map[string]FieldType, len(fieldType.ObjectFields))
+		for name, field := range fieldType.ObjectFields {
+			fields[name] = resolveType(field)
 		}
-		return FieldType{Type: "string"}
+		fieldType.ObjectFields = fields
 	}
+	return fieldType
 }
 
-// InferSchemaFromStruct infers a Schema from a Go struct
+// InferSchemaFromStruct infers a Schema from a Go struct.
+// Field types come from the declared Go types, not from the current values, and a
+// `metadat:"name,omitempty,type=int64"` tag may rename a field or override its type.
+// Slices produce the schema of an array document, and values that are not structs
+// (such as maps) are inferred from their contents.
 func InferSchemaFromStruct(v interface{}) (Schema, error) {
 	schema := Schema{Fields: make(map[string]FieldType)}
-	
-	// Convert to JSON and back to handle nested structs
-	data, err := json.Marshal(v)
+
+	val := reflect.ValueOf(v)
+	for val.IsValid() && val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return schema, fmt.Errorf("cannot infer schema from nil %T", v)
+		}
+		val = val.Elem()
+	}
+	if !val.IsValid() {
+		return schema, fmt.Errorf("cannot infer schema from nil value")
+	}
+
+	types := newGoTypes()
+	if val.Kind() == reflect.Slice || val.Kind() == reflect.Array {
+		arrayType, err := types.infer(val.Type(), val)
+		if err != nil {
+			return schema, err
+		}
+		if err := types.resolve(&schema, &arrayType); err != nil {
+			return schema, err
+		}
+		schema.Fields[arrayDocumentField] = arrayType
+		schema.FieldOrder = []string{arrayDocumentField}
+		return schema, nil
+	}
+
+	if val.Kind() != reflect.Struct {
+		data, err := structToMap(v)
+		if err != nil {
+			return schema, err
+		}
+		return InferSchemaFromJSON(data), nil
+	}
+
+	objectType, err := types.infer(val.Type(), val)
 	if err != nil {
-		return schema, fmt.Errorf("failed to marshal struct: %v", err)
+		return schema, err
 	}
-	
-	var jsonData map[string]interface{}
-	if err := json.Unmarshal(data, &jsonData); err != nil {
-		return schema, fmt.Errorf("failed to unmarshal to map: %v", err)
+	if err := types.resolve(&schema, &objectType); err != nil {
+		return schema, err
 	}
-	
-	return InferSchemaFromJSON(jsonData), nil
+	schema.Fields = objectType.ObjectFields
+	schema.FieldOrder = objectType.ObjectOrder
+
+	return schema, nil
 }
 
 // ValidateData validates data against the schema
 func (s Schema) ValidateData(data map[string]interface{}) error {
-	// Check for required fields
-	for fieldName, fieldType := range s.Fields {
+	if errs := s.ValidateAll(data); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// ValidateAll validates data against the schema and returns every problem found, or nil
+// when the data is valid. Nested objects, arrays and maps are checked all the way down, in
+// schema order, and each problem is a *SchemaError or *TypeError whose Path locates the
+// offending value, such as orders[3].total.
+func (s Schema) ValidateAll(data map[string]interface{}) ErrorList {
+	var errs ErrorList
+
+	for _, fieldName := range s.GetFieldOrder() {
+		fieldType := s.Fields[fieldName]
 		value, exists := data[fieldName]
 		if !exists {
-			continue // Field is optional
-		}
-		
-		if err := validateValue(value, fieldType); err != nil {
-			return fmt.Errorf("validation error for field %s: %v", fieldName, err)
+			if fieldType.Required {
+				errs = append(errs, &SchemaError{Position: Position{Path: fieldName}, Text: fieldName, Msg: "missing required field"})
+			}
+			continue
 		}
+		errs = append(errs, validateValue(value, fieldType, fieldName)...)
 	}
-	
+
 	// Check for unknown fields
-	for fieldName := range data {
+	for _, fieldName := range sortedKeys(data) {
 		if _, exists := s.Fields[fieldName]; !exists {
-			return fmt.Errorf("unknown field: %s", fieldName)
+			errs = append(errs, &SchemaError{Position: Position{Path: fieldName}, Text: fieldName, Msg: "unknown field"})
 		}
 	}
-	
-	return nil
+
+	return errs
 }
 
-// validateValue validates a value against its expected type
-func validateValue(value interface{}, fieldType FieldType) error {
-	switch fieldType.Type {
-	case "string":
-		if _, ok := value.(string); !ok {
-			return fmt.Errorf("expected string, got %T", value)
-		}
-		
-	case "int", "int32", "int64":
-		switch value.(type) {
-		case int, int32, int64, float64:
-			// Accept numeric types
-		default:
-			return fmt.Errorf("expected integer, got %T", value)
-		}
-		
-	case "float32", "float64":
-		switch value.(type) {
-		case float32, float64, int:
-			// Accept numeric types
-		default:
-			return fmt.Errorf("expected float, got %T", value)
-		}
-		
-	case "bool":
-		if _, ok := value.(bool); !ok {
-			return fmt.Errorf("expected bool, got %T", value)
+// validateValue validates a value against its expected type, returning every problem found
+// within it. path locates the value in the document.
+func validateValue(value interface{}, fieldType FieldType, path string) []error {
+	if value == nil {
+		if fieldType.Nullable {
+			return nil
 		}
-		
+		return []error{validationError(value, fieldType, path, fmt.Errorf("null value for non-nullable type %s", fieldTypeToString(fieldType)))}
+	}
+
+	var errs []error
+	switch fieldType.Type {
 	case "array":
 		arr, ok := value.([]interface{})
 		if !ok {
-			return fmt.Errorf("expected array, got %T", value)
+			return []error{validationError(value, fieldType, path, fmt.Errorf("expected array, got %T", value))}
 		}
-		
-		// Validate each element if element type is defined
 		if fieldType.ElementType != nil {
 			for i, elem := range arr {
-				if err := validateValue(elem, *fieldType.ElementType); err != nil {
-					return fmt.Errorf("array element %d: %v", i, err)
-				}
+				errs = append(errs, validateValue(elem, *fieldType.ElementType, path+elementSegment(i))...)
 			}
 		}
-		
+
+	case "map":
+		m, err := toMap(value)
+		if err != nil {
+			return []error{validationError(value, fieldType, path, err)}
+		}
+		for _, key := range sortedKeys(m) {
+			errs = append(errs, validateValue(m[key], *fieldType.ElementType, path+mapKeySegment(key))...)
+		}
+
+	case "union":
+		_, variantType, err := unionVariant(value, fieldType)
+		if err != nil {
+			return []error{validationError(value, fieldType, path, err)}
+		}
+		return validateValue(value, variantType, path)
+
 	case "object":
 		obj, ok := value.(map[string]interface{})
 		if !ok {
-			return fmt.Errorf("expected object, got %T", value)
+			return []error{validationError(value, fieldType, path, fmt.Errorf("expected object, got %T", value))}
 		}
-		
-		// Validate object fields
-		for fieldName, fieldDef := range fieldType.ObjectFields {
-			if val, exists := obj[fieldName]; exists {
-				if err := validateValue(val, fieldDef); err != nil {
-					return fmt.Errorf("object field %s: %v", fieldName, err)
+		for _, fieldName := range getObjectFieldOrder(&fieldType) {
+			fieldDef := fieldType.ObjectFields[fieldName]
+			fieldPath := fieldName
+			if path != "" {
+				fieldPath = path + "." + fieldName
+			}
+			val, exists := obj[fieldName]
+			if !exists {
+				if fieldDef.Required {
+					errs = append(errs, &SchemaError{Position: Position{Path: fieldPath}, Text: fieldName, Msg: "missing required field"})
 				}
+				continue
 			}
+			errs = append(errs, validateValue(val, fieldDef, fieldPath)...)
 		}
-		
+
+	default:
+		if err := validateScalar(value, fieldType); err != nil {
+			return []error{validationError(value, fieldType, path, err)}
+		}
+	}
+	return errs
+}
+
+// validationError reports a value that does not match its type at path
+func validationError(value interface{}, fieldType FieldType, path string, err error) error {
+	return &TypeError{
+		Position: Position{Path: path},
+		Text:     fmt.Sprint(value),
+		Type:     fieldTypeToString(fieldType),
+		Msg:      err.Error(),
+	}
+}
+
+// validateScalar validates a value of a type that holds no other values
+func validateScalar(value interface{}, fieldType FieldType) error {
+	switch fieldType.Type {
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("expected string, got %T", value)
+		}
+
+	case "int", "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64":
+		if _, err := toIntegerValue(value, fieldType); err != nil {
+			return err
+		}
+
+	case "float32", "float64":
+		if _, err := toFloat64(value); err != nil {
+			return err
+		}
+
+	case "bool":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("expected bool, got %T", value)
+		}
+
+	case "timestamp", "date", "duration":
+		if _, err := toTemporal(value, fieldType); err != nil {
+			return err
+		}
+
+	case "bytes":
+		if _, err := toBytes(value, fieldType); err != nil {
+			return err
+		}
+
+	case "enum":
+		if _, err := toEnumValue(value, fieldType); err != nil {
+			return err
+		}
+
+	case "decimal":
+		if _, err := toDecimal(value, fieldType); err != nil {
+			return err
+		}
+
 	default:
 		return fmt.Errorf("unknown type: %s", fieldType.Type)
 	}
-	
 	return nil
-}
\ No newline at end of file
+}
+
+// missingRequired returns the first required field of an object type missing from obj,
+// or an empty string when all of them are present
+func missingRequired(obj map[string]interface{}, fieldType FieldType) string {
+	for _, fieldName := range getObjectFieldOrder(&fieldType) {
+		if !fieldType.ObjectFields[fieldName].Required {
+			continue
+		}
+		if _, exists := obj[fieldName]; !exists {
+			return fieldName
+		}
+	}
+	return ""
+}
+
+// sortedKeys returns the keys of a map in alphabetical order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,117 @@
+package metadat
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Layouts of the temporal types as they appear in the data section
+const (
+	timestampLayout = time.RFC3339Nano
+	dateLayout      = "2006-01-02"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// isTemporalType reports whether a schema type holds a point in time or a duration
+func isTemporalType(t string) bool {
+	return t == "timestamp" || t == "date" || t == "duration"
+}
+
+// parseTemporalValue converts the text of a timestamp, date or duration value. Timestamps
+// and dates become time.Time values, durations time.Duration values.
+func parseTemporalValue(fieldType FieldType, valueStr string) (interface{}, error) {
+	switch fieldType.Type {
+	case "timestamp":
+		t, err := time.Parse(timestampLayout, valueStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp value: %s", valueStr)
+		}
+		return t, nil
+
+	case "date":
+		t, err := time.Parse(dateLayout, valueStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date value: %s", valueStr)
+		}
+		return t, nil
+
+	case "duration":
+		d, err := time.ParseDuration(valueStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration value: %s", valueStr)
+		}
+		return d, nil
+
+	default:
+		return nil, fmt.Errorf("unknown type: %s", fieldType.Type)
+	}
+}
+
+// toTemporal converts a time.Time, time.Duration or the text of one into the Go value
+// of a temporal type
+func toTemporal(value interface{}, fieldType FieldType) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return parseTemporalValue(fieldType, v)
+
+	case time.Time:
+		if fieldType.Type == "duration" {
+			return nil, fmt.Errorf("expected duration, got %T", value)
+		}
+		return v, nil
+
+	case time.Duration:
+		if fieldType.Type != "duration" {
+			return nil, fmt.Errorf("expected time, got %T", value)
+		}
+		return v, nil
+
+	default:
+		return nil, fmt.Errorf("expected %s, got %T", fieldType.Type, value)
+	}
+}
+
+// formatTemporalValue writes a temporal value in its canonical form: RFC 3339 with the
+// original offset for timestamps, YYYY-MM-DD for dates and Go duration syntax for durations
+func formatTemporalValue(value interface{}, fieldType FieldType) (string, error) {
+	v, err := toTemporal(value, fieldType)
+	if err != nil {
+		return "", err
+	}
+
+	switch fieldType.Type {
+	case "timestamp":
+		return v.(time.Time).Format(timestampLayout), nil
+	case "date":
+		return v.(time.Time).Format(dateLayout), nil
+	default:
+		return v.(time.Duration).String(), nil
+	}
+}
+
+// assignTemporal stores a parsed temporal value into a time.Time, a time.Duration or other
+// int64 type holding nanoseconds, or a string holding the canonical text
+func assignTemporal(dst reflect.Value, src interface{}, fieldType FieldType, path string) error {
+	v, err := toTemporal(src, fieldType)
+	if err != nil {
+		return fmt.Errorf("%s: %v", describePath(path), err)
+	}
+
+	switch {
+	case dst.Type() == timeType && fieldType.Type != "duration":
+		dst.Set(reflect.ValueOf(v))
+	case dst.Kind() == reflect.Int64 && fieldType.Type == "duration":
+		dst.SetInt(int64(v.(time.Duration)))
+	case dst.Kind() == reflect.String:
+		text, _ := formatTemporalValue(v, fieldType)
+		dst.SetString(text)
+	default:
+		return assignError(fieldType, dst.Type(), path)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package metadat
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseUnionType parses a union(discriminator){variant:{...}|variant:{...}} type. Each
+// variant is an object type; its name is held by the discriminator field of a value.
+func parseUnionType(typeStr string, scope typeScope) (FieldType, error) {
+	inner := typeStr[len("union("):]
+	closeIndex := strings.Index(inner, ")")
+	if closeIndex == -1 {
+		return FieldType{}, fmt.Errorf("invalid union type: %s", typeStr)
+	}
+	discriminator := strings.TrimSpace(inner[:closeIndex])
+	if !isEnumSymbol(discriminator) {
+		return FieldType{}, fmt.Errorf("invalid union discriminator: %q", discriminator)
+	}
+
+	variantsStr := strings.TrimSpace(inner[closeIndex+1:])
+	if !strings.HasPrefix(variantsStr, "{") || !strings.HasSuffix(variantsStr, "}") {
+		return FieldType{}, fmt.Errorf("invalid union type: %s", typeStr)
+	}
+
+	variants := make(map[string]FieldType)
+	var variantOrder []string
+	for _, pair := range splitObjectFields(variantsStr[1 : len(variantsStr)-1]) {
+		colonIndex := strings.Index(pair, ":")
+		if colonIndex == -1 {
+			return FieldType{}, fmt.Errorf("invalid union variant format: %s", pair)
+		}
+		name := strings.TrimSpace(pair[:colonIndex])
+		if !isEnumSymbol(name) {
+			return FieldType{}, fmt.Errorf("invalid union variant name: %q", name)
+		}
+		if _, exists := variants[name]; exists {
+			return FieldType{}, fmt.Errorf("duplicate union variant: %s", name)
+		}
+
+		variantType, err := parseTypeIn(pair[colonIndex+1:], scope)
+		if err != nil {
+			return FieldType{}, err
+		}
+		// Variants that refer to named types are checked once the reference is resolved
+		if variantType.Type != "" {
+			if err := checkVariant(name, variantType, discriminator); err != nil {
+				return FieldType{}, err
+			}
+		}
+		variants[name] = variantType
+		variantOrder = append(variantOrder, name)
+	}
+	if len(variants) == 0 {
+		return FieldType{}, fmt.Errorf("union type has no variants: %s", typeStr)
+	}
+
+	return FieldType{Type: "union", Discriminator: discriminator, Variants: variants, VariantOrder: variantOrder}, nil
+}
+
+// checkVariant reports a union variant that is not an object type or that declares the
+// discriminator field itself
+func checkVariant(name string, variantType FieldType, discriminator string) error {
+	if variantType.Type != "object" || variantType.Nullable {
+		return fmt.Errorf("union variant %s must be an object type", name)
+	}
+	if _, exists := variantType.ObjectFields[discriminator]; exists {
+		return fmt.Errorf("union variant %s redeclares discriminator field %s", name, discriminator)
+	}
+	return nil
+}
+
+// unionTypeToString writes a union type in schema syntax
+func unionTypeToString(ft FieldType) string {
+	variants := make([]string, len(ft.VariantOrder))
+	for i, name := range ft.VariantOrder {
+		variants[i] = name + ":" + fieldTypeToString(ft.Variants[name])
+	}
+	return "union(" + ft.Discriminator + "){" + strings.Join(variants, "|") + "}"
+}
+
+// unionVariantType returns the object layout of a variant: the discriminator followed by
+// the fields of the variant
+func unionVariantType(fieldType FieldType, name string) (FieldType, error) {
+	variant, exists := fieldType.Variants[name]
+	if !exists {
+		return FieldType{}, fmt.Errorf("unknown variant: %s, expected one of %s", name, strings.Join(fieldType.VariantOrder, "|"))
+	}
+
+	fields := make(map[string]FieldType, len(variant.ObjectFields)+1)
+	for fieldName, fieldDef := range variant.ObjectFields {
+		fields[fieldName] = fieldDef
+	}
+	fields[fieldType.Discriminator] = FieldType{Type: "string", Name: fieldType.Discriminator, Required: true}
+
+	return FieldType{
+		Type:         "object",
+		ObjectFields: fields,
+		ObjectOrder:  append([]string{fieldType.Discriminator}, getObjectFieldOrder(&variant)...),
+	}, nil
+}
+
+// unionVariant returns a union value as an object together with the layout of its variant,
+// checking that it names a known variant and holds only fields of that variant
+func unionVariant(value interface{}, fieldType FieldType) (map[string]interface{}, FieldType, error) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, FieldType{}, fmt.Errorf("expected object, got %T", value)
+	}
+	discriminator, exists := obj[fieldType.Discriminator]
+	if !exists {
+		return nil, FieldType{}, fmt.Errorf("missing discriminator field: %s", fieldType.Discriminator)
+	}
+	name, ok := discriminator.(string)
+	if !ok {
+		return nil, FieldType{}, fmt.Errorf("discriminator field %s: expected string, got %T", fieldType.Discriminator, discriminator)
+	}
+
+	variantType, err := unionVariantType(fieldType, name)
+	if err != nil {
+		return nil, FieldType{}, err
+	}
+	for _, key := range sortedKeys(obj) {
+		if _, exists := variantType.ObjectFields[key]; !exists {
+			return nil, FieldType{}, fmt.Errorf("field %s is not part of variant %s", key, name)
+		}
+	}
+	return obj, variantType, nil
+}
+
+// parseUnionFromLine parses a union value from a pipe-separated line starting at column.
+// The first value names the variant, which decides how the remaining values are read.
+func parseUnionFromLine(line string, column int, fieldType FieldType) (map[string]interface{}, error) {
+	values, _ := splitPipeOffsets(line)
+	name, nameColumn := trimValue(values[0], column)
+	variantType, err := unionVariantType(fieldType, name)
+	if err != nil {
+		return nil, unknownVariant(fieldType, name, 0, nameColumn, err)
+	}
+	return parseObjectFromLine(line, column, &variantType)
+}
+
+// parseUnionBlock parses a union value written one "field: value" entry per line. The
+// discriminator entry may appear anywhere in the block.
+func parseUnionBlock(fieldType FieldType, body []line) (map[string]interface{}, error) {
+	for _, block := range splitBlocks(body) {
+		name, _, valueStr, err := parseFieldHeader(block.header)
+		if err != nil || name != fieldType.Discriminator {
+			continue
+		}
+		value, err := parseFieldValue(FieldType{Type: "string"}, block.header, valueStr, block.body)
+		if err != nil {
+			return nil, annotate(err, name, block.header.num, 0)
+		}
+		variantType, err := unionVariantType(fieldType, value.(string))
+		if err != nil {
+			return nil, unknownVariant(fieldType, value.(string), block.header.num, block.header.indent()+1, err)
+		}
+		return parseObjectBlock(variantType, body)
+	}
+	return nil, &SchemaError{Position: Position{Path: fieldType.Discriminator}, Msg: "missing required field"}
+}
+
+// isUnionFieldHeader reports whether a line is a "field: value" entry of a union value: the
+// discriminator or a field of one of its variants
+func isUnionFieldHeader(l line, fieldType FieldType) bool {
+	name, _, _, err := parseFieldHeader(l)
+	if err != nil {
+		return false
+	}
+	if name == fieldType.Discriminator {
+		return true
+	}
+	for _, variant := range fieldType.Variants {
+		if _, exists := variant.ObjectFields[name]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// unknownVariant reports a discriminator value that names no variant of the union
+func unknownVariant(fieldType FieldType, name string, lineNum, column int, err error) error {
+	return &TypeError{
+		Position: Position{Line: lineNum, Column: column, Path: fieldType.Discriminator},
+		Text:     name,
+		Type:     fieldTypeToString(fieldType),
+		Msg:      err.Error(),
+	}
+}
@@ -0,0 +1,289 @@
+package metadat
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// Unmarshal parses a complete MetaDat document and stores the result in the value pointed to by v.
+// Struct fields are matched by their `metadat` tag name, which takes precedence over the `json`
+// tag name, or by field name when neither tag names the field.
+func Unmarshal(data []byte, v interface{}) error {
+	return NewParser().ParseInto(string(data), v)
+}
+
+// ParseInto parses a complete MetaDat format string and stores the result in the value pointed to by v
+func (p *Parser) ParseInto(content string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("ParseInto requires a non-nil pointer, got %T", v)
+	}
+
+	data, err := p.ParseDocument(content)
+	if data == nil {
+		return err
+	}
+
+	// When collecting errors, the partially parsed document is assigned before the
+	// errors are returned
+	fieldType := p.schema.objectType()
+	if p.schema.IsArray() {
+		fieldType = p.schema.Fields[arrayDocumentField]
+	}
+	if assignErr := assignValue(rv.Elem(), data, fieldType, ""); assignErr != nil {
+		return assignErr
+	}
+	return err
+}
+
+// assignValue stores a parsed value into dst, using fieldType to decide which Go types are acceptable
+func assignValue(dst reflect.Value, src interface{}, fieldType FieldType, path string) error {
+	// Allocate pointers on the way down
+	if dst.Kind() == reflect.Pointer {
+		if src == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assignValue(dst.Elem(), src, fieldType, path)
+	}
+
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	if dst.Kind() == reflect.Interface {
+		if dst.NumMethod() != 0 {
+			return assignError(fieldType, dst.Type(), path)
+		}
+		dst.Set(reflect.ValueOf(src))
+		return nil
+	}
+
+	switch fieldType.Type {
+	case "string":
+		s, ok := src.(string)
+		if !ok {
+			return fmt.Errorf("expected string for %s, got %T", describePath(path), src)
+		}
+		if dst.CanAddr() && dst.Addr().Type().Implements(textUnmarshalerType) {
+			if err := dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+				return fmt.Errorf("cannot unmarshal %s: %v", describePath(path), err)
+			}
+			return nil
+		}
+		if dst.Kind() != reflect.String {
+			return assignError(fieldType, dst.Type(), path)
+		}
+		dst.SetString(s)
+
+	case "int", "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64":
+		return assignInteger(dst, src, fieldType, path)
+
+	case "float32", "float64":
+		f, err := toFloat64(src)
+		if err != nil {
+			return fmt.Errorf("%s: %v", describePath(path), err)
+		}
+		switch dst.Kind() {
+		case reflect.Float32, reflect.Float64:
+			if dst.OverflowFloat(f) {
+				return fmt.Errorf("value %v overflows Go type %s for %s", f, dst.Type(), describePath(path))
+			}
+			dst.SetFloat(f)
+		default:
+			return assignError(fieldType, dst.Type(), path)
+		}
+
+	case "bool":
+		b, err := toBool(src)
+		if err != nil {
+			return fmt.Errorf("%s: %v", describePath(path), err)
+		}
+		if dst.Kind() != reflect.Bool {
+			return assignError(fieldType, dst.Type(), path)
+		}
+		dst.SetBool(b)
+
+	case "timestamp", "date", "duration":
+		return assignTemporal(dst, src, fieldType, path)
+
+	case "bytes":
+		return assignBytes(dst, src, fieldType, path)
+
+	case "enum":
+		return assignEnum(dst, src, fieldType, path)
+
+	case "decimal":
+		return assignDecimal(dst, src, fieldType, path)
+
+	case "array":
+		return assignArray(dst, src, fieldType, path)
+
+	case "map":
+		return assignMap(dst, src, fieldType, path)
+
+	case "object":
+		return assignObject(dst, src, fieldType, path)
+
+	case "union":
+		_, variantType, err := unionVariant(src, fieldType)
+		if err != nil {
+			return fmt.Errorf("%s: %v", describePath(path), err)
+		}
+		return assignObject(dst, src, variantType, path)
+
+	default:
+		return fmt.Errorf("unknown type %s for %s", fieldType.Type, describePath(path))
+	}
+
+	return nil
+}
+
+// assignArray stores a parsed array into a Go slice or array
+func assignArray(dst reflect.Value, src interface{}, fieldType FieldType, path string) error {
+	arr, ok := src.([]interface{})
+	if !ok {
+		return fmt.Errorf("expected array for %s, got %T", describePath(path), src)
+	}
+	if fieldType.ElementType == nil {
+		return fmt.Errorf("array %s has no element type", describePath(path))
+	}
+
+	switch dst.Kind() {
+	case reflect.Slice:
+		slice := reflect.MakeSlice(dst.Type(), len(arr), len(arr))
+		for i, item := range arr {
+			if err := assignValue(slice.Index(i), item, *fieldType.ElementType, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+
+	case reflect.Array:
+		if dst.Len() != len(arr) {
+			return fmt.Errorf("cannot assign %d elements to Go type %s for %s", len(arr), dst.Type(), describePath(path))
+		}
+		for i, item := range arr {
+			if err := assignValue(dst.Index(i), item, *fieldType.ElementType, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return assignError(fieldType, dst.Type(), path)
+	}
+
+	return nil
+}
+
+// assignObject stores a parsed object into a Go struct or string-keyed map
+func assignObject(dst reflect.Value, src interface{}, fieldType FieldType, path string) error {
+	obj, ok := src.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("expected object for %s, got %T", describePath(path), src)
+	}
+
+	switch dst.Kind() {
+	case reflect.Struct:
+		fields := structFields(dst.Type())
+		for _, name := range getObjectFieldOrder(&fieldType) {
+			value, exists := obj[name]
+			if !exists {
+				continue
+			}
+			sf, found := lookupStructField(fields, name)
+			if !found {
+				// Fields without a Go counterpart are ignored, as encoding/json does
+				continue
+			}
+			if err := assignValue(fieldByIndex(dst, sf.index), value, fieldType.ObjectFields[name], joinPath(path, name)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if dst.Type().Key().Kind() != reflect.String {
+			return assignError(fieldType, dst.Type(), path)
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(dst.Type(), len(obj)))
+		}
+		for _, name := range getObjectFieldOrder(&fieldType) {
+			value, exists := obj[name]
+			if !exists {
+				continue
+			}
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := assignValue(elem, value, fieldType.ObjectFields[name], joinPath(path, name)); err != nil {
+				return err
+			}
+			dst.SetMapIndex(reflect.ValueOf(name).Convert(dst.Type().Key()), elem)
+		}
+
+	default:
+		return assignError(fieldType, dst.Type(), path)
+	}
+
+	return nil
+}
+
+// assignError reports a schema type that cannot be stored in a Go type
+func assignError(fieldType FieldType, t reflect.Type, path string) error {
+	return fmt.Errorf("cannot assign schema type %s to Go type %s for %s", fieldTypeToString(fieldType), t, describePath(path))
+}
+
+// joinPath appends a field name to a dotted field path
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// describePath names a field path in error messages
+func describePath(path string) string {
+	if path == "" {
+		return "document root"
+	}
+	if strings.HasPrefix(path, "[") {
+		return "element " + path
+	}
+	return "field " + path
+}
+
+// toFloat64 converts a parsed number to float64
+func toFloat64(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float32:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	default:
+		negative, magnitude, err := integerParts(v)
+		if err != nil {
+			return 0, fmt.Errorf("expected float, got %T", v)
+		}
+		if negative {
+			return -float64(magnitude), nil
+		}
+		return float64(magnitude), nil
+	}
+}
+
+// toBool converts a parsed boolean to bool
+func toBool(v interface{}) (bool, error) {
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	default:
+		return false, fmt.Errorf("expected bool, got %T", v)
+	}
+}